@@ -9,6 +9,8 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"io"
+
+	"github.com/pkg/errors"
 )
 
 func Encrypt(object interface{}, secret string) (string, error) {
@@ -57,6 +59,9 @@ func DecryptString(data string, secret string) (string, error) {
 	if err != nil {
 		return "", StringError(err)
 	}
+	if len(cipherText) < aes.BlockSize {
+		return "", StringError(errors.New("cipher text too short"))
+	}
 	iv := cipherText[:aes.BlockSize]
 
 	cipherText = cipherText[aes.BlockSize:]
@@ -71,3 +76,12 @@ func ToSha256(v string) string {
 	bs := sha256.Sum256([]byte(v))
 	return hex.EncodeToString(bs[:])
 }
+
+// RandomToken returns a hex encoded string built from size bytes of crypto/rand
+func RandomToken(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, buffer); err != nil {
+		return "", StringError(err)
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -3,13 +3,18 @@ package database
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"log"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/String-xyz/go-lib/v2/common"
 	serror "github.com/String-xyz/go-lib/v2/stringerror"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	redistrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/go-redis/redis.v8"
 )
 
 type RedisRepresentable interface {
@@ -21,94 +26,461 @@ type RedisRepresentable interface {
 	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
 	HLen(ctx context.Context, key string) *redis.IntCmd
 	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd
+	HExists(ctx context.Context, key, field string) *redis.BoolCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(ctx context.Context, script string) *redis.StringCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	IncrBy(ctx context.Context, key string, value int64) *redis.IntCmd
+	Decr(ctx context.Context, key string) *redis.IntCmd
+	DecrBy(ctx context.Context, key string, decrement int64) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	TTL(ctx context.Context, key string) *redis.DurationCmd
+	Persist(ctx context.Context, key string) *redis.BoolCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	MSet(ctx context.Context, values ...interface{}) *redis.StatusCmd
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	SIsMember(ctx context.Context, key string, member interface{}) *redis.BoolCmd
+	SCard(ctx context.Context, key string) *redis.IntCmd
+	ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	ZScore(ctx context.Context, key, member string) *redis.FloatCmd
+	ZCard(ctx context.Context, key string) *redis.IntCmd
+	ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd
+	LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	LPop(ctx context.Context, key string) *redis.StringCmd
+	RPop(ctx context.Context, key string) *redis.StringCmd
+	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	LLen(ctx context.Context, key string) *redis.IntCmd
+	LRem(ctx context.Context, key string, count int64, value interface{}) *redis.IntCmd
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
 }
 
 type RedisStore interface {
+	// Get returns NOT_FOUND if the key does not exist
 	Get(id string) ([]byte, error)
 	Set(string, any, time.Duration) error
+
+	// Hashes, HGetAll and HMLen return NOT_FOUND if the key does not exist and HGet if the key
+	// or the field does not. Redis deletes a hash with its last field, so an empty hash is missing.
 	HSet(string, map[string]interface{}) error
 	HGetAll(string) (map[string]string, error)
-	HDel(string, string) int64
-	HMLen(string) int64
+	HGet(key, field string) ([]byte, error)
+	// HMGet returns the values of the fields that exist
+	HMGet(key string, fields ...string) (map[string][]byte, error)
+	HExists(key, field string) (bool, error)
+	HDel(key string, fields ...string) (int64, error)
+	HMLen(string) (int64, error)
+
 	Delete(string) error
+	// SetNX sets the value only if the key does not exist yet, reporting whether it was set
+	SetNX(string, any, time.Duration) (bool, error)
+	// Eval runs the script with EVALSHA, falling back to EVAL when it is not cached by the server.
+	// In a pipeline the script is loaded first and its result is not available.
+	Eval(script *redis.Script, keys []string, args ...interface{}) (interface{}, error)
+	// WithContext returns a copy of the store whose commands run with ctx
+	WithContext(ctx context.Context) RedisStore
+
+	// Counters
+	Incr(string) (int64, error)
+	IncrBy(string, int64) (int64, error)
+	Decr(string) (int64, error)
+	DecrBy(string, int64) (int64, error)
+
+	// Expiration, Expire, TTL and Persist return NOT_FOUND if the key does not exist
+	Expire(string, time.Duration) error
+	// TTL returns a negative duration for keys without expiration
+	TTL(string) (time.Duration, error)
+	// Persist removes the expiration of the key, keys without expiration are left as is
+	Persist(string) error
+	Exists(...string) (int64, error)
+
+	// MGet returns the values of the keys that exist, in cluster mode all keys must share a hash slot
+	MGet(...string) (map[string][]byte, error)
+	MSet(map[string]interface{}) error
+
+	// Sets
+	SAdd(string, ...interface{}) (int64, error)
+	SRem(string, ...interface{}) (int64, error)
+	SMembers(string) ([]string, error)
+	SIsMember(string, interface{}) (bool, error)
+	SCard(string) (int64, error)
+
+	// Sorted sets, ZScore returns NOT_FOUND if the member does not exist
+	ZAdd(string, ...*redis.Z) (int64, error)
+	ZRem(string, ...interface{}) (int64, error)
+	ZScore(key, member string) (float64, error)
+	ZCard(string) (int64, error)
+	ZRange(key string, start, stop int64) ([]string, error)
+	ZRangeByScore(string, *redis.ZRangeBy) ([]string, error)
+	ZRemRangeByScore(key, min, max string) (int64, error)
+
+	// Lists, LPop and RPop return NOT_FOUND if the list is empty
+	LPush(string, ...interface{}) (int64, error)
+	RPush(string, ...interface{}) (int64, error)
+	LPop(string) ([]byte, error)
+	RPop(string) ([]byte, error)
+	LRange(key string, start, stop int64) ([]string, error)
+	LLen(string) (int64, error)
+	LRem(key string, count int64, value interface{}) (int64, error)
+
+	// Pub/sub, the subscription is closed when ctx is done
+	Publish(channel string, message interface{}) error
+	Subscribe(ctx context.Context, channels ...string) (*Subscription, error)
+
+	// Streams
+	XAdd(stream string, values map[string]interface{}, maxLen int64) (string, error)
+	// XGroupCreate creates the consumer group and the stream if needed, it is a no-op if the group exists
+	XGroupCreate(stream, group, start string) error
+	// XReadGroup returns an empty list when nothing arrived during block
+	XReadGroup(stream, group, consumer string, count int64, block time.Duration) ([]redis.XMessage, error)
+	XAck(stream, group string, ids ...string) (int64, error)
+	// XPending lists up to count entries pending between start and end, "-" and "+" included,
+	// with how many times each was delivered. An empty consumer lists the entries of every consumer.
+	XPending(stream, group, start, end string, count int64, consumer string) ([]redis.XPendingExt, error)
+	// XAutoClaim transfers entries pending for more than minIdle to consumer, requires redis 6.2
+	XAutoClaim(stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redis.XMessage, string, error)
+
+	// Pipelines and transactions. Commands queued on pipe return zero values, they are sent
+	// together once fn returns, and in TxPipelined they run atomically with MULTI/EXEC.
+	Pipelined(fn func(pipe RedisStore) error) error
+	TxPipelined(fn func(pipe RedisStore) error) error
+	// Watch runs fn, whose reads see the keys as they are, and fails with TX_CONFLICT if
+	// one of the keys changed before the writes fn queues with tx.TxPipelined are executed
+	Watch(fn func(tx RedisStore) error, keys ...string) error
+
+	// Stats counts the hits and misses of Get, HGet, HGetAll and MGet since the store was created
+	Stats() RedisStats
+
+	// Healthy pings redis, meant for readiness probes
+	Healthy(ctx context.Context) error
 }
 
 type redisStore struct {
 	client RedisRepresentable
+	ctx    context.Context
+	// parent is the client a pipeline was started from, nil outside pipelines
+	parent RedisRepresentable
+	// scripts are the hashes of the scripts known to be loaded, for EVALSHA in pipelines
+	scripts *sync.Map
+	stats   *redisStats
 }
 
 type RedisConfigOptions struct {
 	ClusterMode bool
 	Port        string
 	Host        string
-	Password    string
+	// Addrs overrides Host and Port, e.g. with several cluster seed nodes, there must be
+	// only one outside cluster mode
+	Addrs    []string
+	Username string
+	Password string
+	// DB is the database index, cluster mode only has DB 0
+	DB int
+
+	// SentinelMode connects to the master named SentinelMasterName through the sentinels at SentinelAddrs,
+	// both are required
+	SentinelMode       bool
+	SentinelMasterName string
+	SentinelAddrs      []string
+	SentinelPassword   string
+
+	// Pool and timeouts, zero values use the go-redis defaults
+	PoolSize     int
+	MinIdleConns int
+	MaxRetries   int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PoolTimeout  time.Duration
+
+	// TLS is enabled outside of the local env unless DisableTLS is set
+	DisableTLS bool
+	// CACert is a PEM encoded CA to trust in addition to the system ones
+	CACert string
+	// CACertFile is the path of a PEM encoded CA to trust in addition to the system ones
+	CACertFile         string
+	InsecureSkipVerify bool
+
+	// LazyConnect skips the initial ping, the first command opens the connection
+	LazyConnect bool
+	// ConnectRetries is how many times the initial ping is retried, nil defaults to 5
+	// and a pointer to 0 pings only once
+	ConnectRetries *int
+	// ConnectBackoff is the delay before the first retry, doubled on every retry, defaults to 500ms
+	ConnectBackoff time.Duration
+
+	// every command is a datadog span, child of the span in the context bound with WithContext
+	DisableTracing bool
+	// TraceServiceName defaults to $SERVICE_NAME-redis
+	TraceServiceName string
+	// TraceRawCommands tags spans with the full command, values included
+	TraceRawCommands bool
 }
 
+// Deprecated: compare with errors.Is(err, redis.Nil), or serror.NOT_FOUND for errors returned by RedisStore
 const REDIS_NOT_FOUND_ERROR = "redis: nil"
 
-func redisTLSConf() *tls.Config {
-	var tlsCf *tls.Config
-	if !common.IsLocalEnv() {
-		tlsCf = &tls.Config{
-			MinVersion: tls.VersionTLS12,
+func redisTLSConf(options RedisConfigOptions) (*tls.Config, error) {
+	if common.IsLocalEnv() || options.DisableTLS {
+		return nil, nil
+	}
+
+	tlsCf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	ca := []byte(options.CACert)
+	if options.CACertFile != "" {
+		file, err := os.ReadFile(options.CACertFile)
+		if err != nil {
+			return nil, common.StringError(err)
 		}
+		ca = append(ca, file...)
+	}
+	if len(ca) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, common.StringError(errors.New("invalid redis CA certificate"))
+		}
+		tlsCf.RootCAs = pool
 	}
 
-	return tlsCf
+	return tlsCf, nil
 }
 
-func redisOptions(host, port, password string) *redis.Options {
-	url := host + ":" + port
-	var tlsCf *tls.Config
-	if !common.IsLocalEnv() {
-		tlsCf = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		}
+func redisAddrs(options RedisConfigOptions) []string {
+	if len(options.Addrs) > 0 {
+		return options.Addrs
 	}
+	return []string{options.Host + ":" + options.Port}
+}
 
-	op := &redis.Options{
-		Addr:      url,
-		TLSConfig: tlsCf,
-		Password:  password,
-		DB:        0,
+func redisOptions(options RedisConfigOptions, tlsCf *tls.Config) *redis.Options {
+	return &redis.Options{
+		Addr:         redisAddrs(options)[0],
+		TLSConfig:    tlsCf,
+		Username:     options.Username,
+		Password:     options.Password,
+		DB:           options.DB,
+		PoolSize:     options.PoolSize,
+		MinIdleConns: options.MinIdleConns,
+		MaxRetries:   options.MaxRetries,
+		DialTimeout:  options.DialTimeout,
+		ReadTimeout:  options.ReadTimeout,
+		WriteTimeout: options.WriteTimeout,
+		PoolTimeout:  options.PoolTimeout,
 	}
-	return op
 }
 
-func cluster(host, port, password string) *redis.ClusterClient {
-	url := host + ":" + port
-	return redis.NewClusterClient(&redis.ClusterOptions{
-		Addrs:          []string{url},
-		Password:       password,
-		PoolSize:       10,
-		MinIdleConns:   10,
-		TLSConfig:      redisTLSConf(),
+func clusterOptions(options RedisConfigOptions, tlsCf *tls.Config) *redis.ClusterOptions {
+	poolSize := options.PoolSize
+	if poolSize == 0 {
+		poolSize = 10
+	}
+	minIdleConns := options.MinIdleConns
+	if minIdleConns == 0 {
+		minIdleConns = 10
+	}
+
+	return &redis.ClusterOptions{
+		Addrs:          redisAddrs(options),
+		Username:       options.Username,
+		Password:       options.Password,
+		PoolSize:       poolSize,
+		MinIdleConns:   minIdleConns,
+		MaxRetries:     options.MaxRetries,
+		DialTimeout:    options.DialTimeout,
+		ReadTimeout:    options.ReadTimeout,
+		WriteTimeout:   options.WriteTimeout,
+		PoolTimeout:    options.PoolTimeout,
+		TLSConfig:      tlsCf,
 		ReadOnly:       false,
 		RouteRandomly:  false,
 		RouteByLatency: false,
-	})
+	}
 }
 
-func NewRedisStore(options RedisConfigOptions) RedisStore {
-	ctx := context.Background()
-	var client RedisRepresentable
-	if !options.ClusterMode {
-		client = redis.NewClient(redisOptions(options.Host, options.Port, options.Password))
-	} else {
-		client = cluster(options.Host, options.Port, options.Password)
+func failoverOptions(options RedisConfigOptions, tlsCf *tls.Config) *redis.FailoverOptions {
+	return &redis.FailoverOptions{
+		MasterName:       options.SentinelMasterName,
+		SentinelAddrs:    options.SentinelAddrs,
+		SentinelPassword: options.SentinelPassword,
+		Username:         options.Username,
+		Password:         options.Password,
+		DB:               options.DB,
+		PoolSize:         options.PoolSize,
+		MinIdleConns:     options.MinIdleConns,
+		MaxRetries:       options.MaxRetries,
+		DialTimeout:      options.DialTimeout,
+		ReadTimeout:      options.ReadTimeout,
+		WriteTimeout:     options.WriteTimeout,
+		PoolTimeout:      options.PoolTimeout,
+		TLSConfig:        tlsCf,
+	}
+}
+
+func newRedisClient(options RedisConfigOptions) (RedisRepresentable, error) {
+	if options.ClusterMode && options.SentinelMode {
+		return nil, common.StringError(errors.New("redis cluster and sentinel modes are exclusive"))
 	}
-	_, err := client.Ping(ctx).Result()
+	if err := validRedisMode(options); err != nil {
+		return nil, common.StringError(err)
+	}
+
+	tlsCf, err := redisTLSConf(options)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	var client redis.UniversalClient
+	switch {
+	case options.ClusterMode:
+		client = redis.NewClusterClient(clusterOptions(options, tlsCf))
+	case options.SentinelMode:
+		client = redis.NewFailoverClient(failoverOptions(options, tlsCf))
+	default:
+		client = redis.NewClient(redisOptions(options, tlsCf))
+	}
+
+	if !options.DisableTracing {
+		redistrace.WrapClient(client, traceOptions(options)...)
+	}
+	return client, nil
+}
+
+// validRedisMode rejects the options the client of the mode would ignore
+func validRedisMode(options RedisConfigOptions) error {
+	switch {
+	case options.ClusterMode:
+		if options.DB != 0 {
+			return errors.New("redis cluster mode only supports DB 0")
+		}
+	case options.SentinelMode:
+		if options.SentinelMasterName == "" {
+			return errors.New("redis sentinel mode needs a SentinelMasterName")
+		}
+		if len(options.SentinelAddrs) == 0 {
+			return errors.New("redis sentinel mode needs SentinelAddrs")
+		}
+	default:
+		if len(options.Addrs) > 1 {
+			return errors.New("redis takes a single address outside cluster mode, use ClusterMode or SentinelMode")
+		}
+	}
+	return nil
+}
+
+func traceOptions(options RedisConfigOptions) []redistrace.ClientOption {
+	traceOptions := []redistrace.ClientOption{redistrace.WithSkipRawCommand(!options.TraceRawCommands)}
+
+	serviceName := options.TraceServiceName
+	if serviceName == "" && os.Getenv("SERVICE_NAME") != "" {
+		serviceName = os.Getenv("SERVICE_NAME") + "-redis"
+	}
+	if serviceName != "" {
+		traceOptions = append(traceOptions, redistrace.WithServiceName(serviceName))
+	}
+	return traceOptions
+}
+
+// NewRedisStore connects to redis and exits the process if it is unreachable, use
+// OpenRedisStore to handle the error instead. With the default retries and backoff an
+// unreachable redis blocks for about 15 seconds before exiting, set ConnectRetries,
+// ConnectBackoff or LazyConnect to change that.
+func NewRedisStore(options RedisConfigOptions) RedisStore {
+	store, err := OpenRedisStore(options)
 	if err != nil {
 		log.Fatalf("Failed to ping Redis: %v", err)
 	}
+	return store
+}
 
+// OpenRedisStore connects to redis, retrying the initial ping with exponential backoff
+// unless LazyConnect is set
+func OpenRedisStore(options RedisConfigOptions) (RedisStore, error) {
+	client, err := newRedisClient(options)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	if !options.LazyConnect {
+		if err := connect(client, options); err != nil {
+			return nil, common.StringError(err)
+		}
+	}
+
+	return NewRedisStoreFromClient(client), nil
+}
+
+// NewRedisStoreFromClient wraps an existing client, e.g. to share it or to test with a fake
+func NewRedisStoreFromClient(client RedisRepresentable) RedisStore {
 	return &redisStore{
-		client: client,
+		client:  client,
+		scripts: &sync.Map{},
+		stats:   &redisStats{},
 	}
 }
 
-func (r redisStore) Delete(id string) error {
+func connect(client RedisRepresentable, options RedisConfigOptions) error {
+	retries := 5
+	if options.ConnectRetries != nil {
+		retries = *options.ConnectRetries
+	}
+	backoff := options.ConnectBackoff
+	if backoff == 0 {
+		backoff = 500 * time.Millisecond
+	}
+
 	ctx := context.Background()
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = client.Ping(ctx).Err(); err == nil {
+			return nil
+		}
+	}
+	return common.StringError(err)
+}
+
+func (r redisStore) WithContext(ctx context.Context) RedisStore {
+	bound := r
+	bound.ctx = ctx
+	return &bound
+}
+
+// context returns the context bound with WithContext, or context.Background if none
+func (r redisStore) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+func (r redisStore) Delete(id string) error {
+	ctx := r.context()
 	_, err := r.client.Del(ctx, id).Result()
 	if err != nil {
 		return common.StringError(err)
@@ -117,21 +489,23 @@ func (r redisStore) Delete(id string) error {
 }
 
 func (r redisStore) Get(id string) ([]byte, error) {
-	ctx := context.Background()
+	ctx := r.context()
 	bytes, err := r.client.Get(ctx, id).Bytes()
 	if err != nil {
 
-		if err.Error() == REDIS_NOT_FOUND_ERROR {
+		if errors.Is(err, redis.Nil) {
+			r.miss()
 			return nil, common.StringError(serror.NOT_FOUND)
 		}
 
 		return nil, common.StringError(err)
 	}
+	r.hit()
 	return bytes, nil
 }
 
 func (r redisStore) Set(id string, value any, expire time.Duration) error {
-	ctx := context.Background()
+	ctx := r.context()
 	if err := r.client.Set(ctx, id, value, expire).Err(); err != nil {
 		return common.StringError(err)
 	}
@@ -139,7 +513,7 @@ func (r redisStore) Set(id string, value any, expire time.Duration) error {
 }
 
 func (r redisStore) HSet(key string, data map[string]interface{}) error {
-	ctx := context.Background()
+	ctx := r.context()
 	if err := r.client.HSet(ctx, key, data).Err(); err != nil {
 		return common.StringError(err, "failed to save array to redis")
 	}
@@ -147,28 +521,408 @@ func (r redisStore) HSet(key string, data map[string]interface{}) error {
 	return nil
 }
 
+// HGetAll returns NOT_FOUND if the key does not exist, redis never keeps empty hashes
 func (r redisStore) HGetAll(key string) (map[string]string, error) {
-	ctx := context.Background()
+	ctx := r.context()
 	data, err := r.client.HGetAll(ctx, key).Result()
 	if err != nil {
+		return nil, common.StringError(err)
+	}
+	if len(data) == 0 && !r.queued() {
+		r.miss()
+		return nil, common.StringError(serror.NOT_FOUND)
+	}
+	r.hit()
+	return data, nil
+}
 
-		if err.Error() == REDIS_NOT_FOUND_ERROR {
+func (r redisStore) HGet(key, field string) ([]byte, error) {
+	ctx := r.context()
+	bytes, err := r.client.HGet(ctx, key, field).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			r.miss()
 			return nil, common.StringError(serror.NOT_FOUND)
 		}
+		return nil, common.StringError(err)
+	}
+	r.hit()
+	return bytes, nil
+}
 
-		return data, common.StringError(err)
+func (r redisStore) HMGet(key string, fields ...string) (map[string][]byte, error) {
+	ctx := r.context()
+	values, err := r.client.HMGet(ctx, key, fields...).Result()
+	if err != nil {
+		return nil, common.StringError(err)
 	}
-	return data, nil
+
+	result := make(map[string][]byte, len(fields))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			result[fields[i]] = []byte(s)
+		}
+	}
+	return result, nil
 }
 
-func (r redisStore) HMLen(key string) int64 {
-	ctx := context.Background()
-	data := r.client.HLen(ctx, key)
-	return data.Val()
+func (r redisStore) HExists(key, field string) (bool, error) {
+	ctx := r.context()
+	exists, err := r.client.HExists(ctx, key, field).Result()
+	if err != nil {
+		return false, common.StringError(err)
+	}
+	return exists, nil
 }
 
-func (r redisStore) HDel(key, val string) int64 {
-	ctx := context.Background()
-	data := r.client.HDel(ctx, key, val)
-	return data.Val()
+func (r redisStore) HMLen(key string) (int64, error) {
+	ctx := r.context()
+	length, err := r.client.HLen(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	if length == 0 && !r.queued() {
+		return 0, common.StringError(serror.NOT_FOUND)
+	}
+	return length, nil
+}
+
+func (r redisStore) HDel(key string, fields ...string) (int64, error) {
+	ctx := r.context()
+	deleted, err := r.client.HDel(ctx, key, fields...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return deleted, nil
+}
+
+func (r redisStore) SetNX(id string, value any, expire time.Duration) (bool, error) {
+	ctx := r.context()
+	ok, err := r.client.SetNX(ctx, id, value, expire).Result()
+	if err != nil {
+		return false, common.StringError(err)
+	}
+	return ok, nil
+}
+
+func (r redisStore) Eval(script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	ctx := r.context()
+	if r.queued() {
+		return nil, r.queueScript(script, keys, args...)
+	}
+	result, err := script.Run(ctx, r.client, keys, args...).Result()
+	if err != nil {
+
+		if errors.Is(err, redis.Nil) {
+			return nil, common.StringError(serror.NOT_FOUND)
+		}
+
+		return nil, common.StringError(err)
+	}
+	return result, nil
+}
+
+func (r redisStore) Incr(key string) (int64, error) {
+	ctx := r.context()
+	value, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return value, nil
+}
+
+func (r redisStore) IncrBy(key string, increment int64) (int64, error) {
+	ctx := r.context()
+	value, err := r.client.IncrBy(ctx, key, increment).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return value, nil
+}
+
+func (r redisStore) Decr(key string) (int64, error) {
+	ctx := r.context()
+	value, err := r.client.Decr(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return value, nil
+}
+
+func (r redisStore) DecrBy(key string, decrement int64) (int64, error) {
+	ctx := r.context()
+	value, err := r.client.DecrBy(ctx, key, decrement).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return value, nil
+}
+
+func (r redisStore) Expire(key string, expire time.Duration) error {
+	ctx := r.context()
+	ok, err := r.client.Expire(ctx, key, expire).Result()
+	if err != nil {
+		return common.StringError(err)
+	}
+	if !ok && !r.queued() {
+		return common.StringError(serror.NOT_FOUND)
+	}
+	return nil
+}
+
+func (r redisStore) TTL(key string) (time.Duration, error) {
+	ctx := r.context()
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	// -2 means the key does not exist, -1 that it has no expiration
+	if ttl == -2 && !r.queued() {
+		return 0, common.StringError(serror.NOT_FOUND)
+	}
+	return ttl, nil
+}
+
+func (r redisStore) Persist(key string) error {
+	ctx := r.context()
+	ok, err := r.client.Persist(ctx, key).Result()
+	if err != nil {
+		return common.StringError(err)
+	}
+	if ok || r.queued() {
+		return nil
+	}
+	// PERSIST also answers 0 for keys that exist without expiration
+	count, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return common.StringError(err)
+	}
+	if count == 0 {
+		return common.StringError(serror.NOT_FOUND)
+	}
+	return nil
+}
+
+func (r redisStore) Exists(keys ...string) (int64, error) {
+	ctx := r.context()
+	count, err := r.client.Exists(ctx, keys...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return count, nil
+}
+
+func (r redisStore) MGet(keys ...string) (map[string][]byte, error) {
+	ctx := r.context()
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	found := make(map[string][]byte, len(values))
+	for i, value := range values {
+		// missing keys come back as nil
+		if str, ok := value.(string); ok {
+			found[keys[i]] = []byte(str)
+			r.hit()
+		} else {
+			r.miss()
+		}
+	}
+	return found, nil
+}
+
+func (r redisStore) MSet(values map[string]interface{}) error {
+	ctx := r.context()
+	if err := r.client.MSet(ctx, values).Err(); err != nil {
+		return common.StringError(err)
+	}
+	return nil
+}
+
+func (r redisStore) SAdd(key string, members ...interface{}) (int64, error) {
+	ctx := r.context()
+	added, err := r.client.SAdd(ctx, key, members...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return added, nil
+}
+
+func (r redisStore) SRem(key string, members ...interface{}) (int64, error) {
+	ctx := r.context()
+	removed, err := r.client.SRem(ctx, key, members...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return removed, nil
+}
+
+func (r redisStore) SMembers(key string) ([]string, error) {
+	ctx := r.context()
+	members, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	return members, nil
+}
+
+func (r redisStore) SIsMember(key string, member interface{}) (bool, error) {
+	ctx := r.context()
+	ok, err := r.client.SIsMember(ctx, key, member).Result()
+	if err != nil {
+		return false, common.StringError(err)
+	}
+	return ok, nil
+}
+
+func (r redisStore) SCard(key string) (int64, error) {
+	ctx := r.context()
+	count, err := r.client.SCard(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return count, nil
+}
+
+func (r redisStore) ZAdd(key string, members ...*redis.Z) (int64, error) {
+	ctx := r.context()
+	added, err := r.client.ZAdd(ctx, key, members...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return added, nil
+}
+
+func (r redisStore) ZRem(key string, members ...interface{}) (int64, error) {
+	ctx := r.context()
+	removed, err := r.client.ZRem(ctx, key, members...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return removed, nil
+}
+
+func (r redisStore) ZScore(key, member string) (float64, error) {
+	ctx := r.context()
+	score, err := r.client.ZScore(ctx, key, member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, common.StringError(serror.NOT_FOUND)
+		}
+		return 0, common.StringError(err)
+	}
+	return score, nil
+}
+
+func (r redisStore) ZCard(key string) (int64, error) {
+	ctx := r.context()
+	count, err := r.client.ZCard(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return count, nil
+}
+
+func (r redisStore) ZRange(key string, start, stop int64) ([]string, error) {
+	ctx := r.context()
+	members, err := r.client.ZRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	return members, nil
+}
+
+func (r redisStore) ZRangeByScore(key string, opt *redis.ZRangeBy) ([]string, error) {
+	ctx := r.context()
+	members, err := r.client.ZRangeByScore(ctx, key, opt).Result()
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	return members, nil
+}
+
+func (r redisStore) ZRemRangeByScore(key, min, max string) (int64, error) {
+	ctx := r.context()
+	removed, err := r.client.ZRemRangeByScore(ctx, key, min, max).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return removed, nil
+}
+
+func (r redisStore) LPush(key string, values ...interface{}) (int64, error) {
+	ctx := r.context()
+	length, err := r.client.LPush(ctx, key, values...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return length, nil
+}
+
+func (r redisStore) RPush(key string, values ...interface{}) (int64, error) {
+	ctx := r.context()
+	length, err := r.client.RPush(ctx, key, values...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return length, nil
+}
+
+func (r redisStore) LPop(key string) ([]byte, error) {
+	ctx := r.context()
+	bytes, err := r.client.LPop(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, common.StringError(serror.NOT_FOUND)
+		}
+		return nil, common.StringError(err)
+	}
+	return bytes, nil
+}
+
+func (r redisStore) RPop(key string) ([]byte, error) {
+	ctx := r.context()
+	bytes, err := r.client.RPop(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, common.StringError(serror.NOT_FOUND)
+		}
+		return nil, common.StringError(err)
+	}
+	return bytes, nil
+}
+
+func (r redisStore) LRange(key string, start, stop int64) ([]string, error) {
+	ctx := r.context()
+	values, err := r.client.LRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	return values, nil
+}
+
+func (r redisStore) LLen(key string) (int64, error) {
+	ctx := r.context()
+	length, err := r.client.LLen(ctx, key).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return length, nil
+}
+
+func (r redisStore) LRem(key string, count int64, value interface{}) (int64, error) {
+	ctx := r.context()
+	removed, err := r.client.LRem(ctx, key, count, value).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return removed, nil
+}
+
+func (r redisStore) Healthy(ctx context.Context) error {
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		return common.StringError(err)
+	}
+	return nil
 }
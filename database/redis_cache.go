@@ -0,0 +1,414 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+
+	"github.com/rs/zerolog/log"
+)
+
+// published on the invalidation channel to clear every cache
+const invalidateAll = "*"
+
+type CacheOptions struct {
+	// Size is how many keys are kept in memory, the least recently used are evicted first, defaults to 10000
+	Size int
+	// TTL is how long a value is served from memory, it bounds how stale a value can get
+	// if an invalidation is missed, defaults to 1 minute
+	TTL time.Duration
+	// NegativeTTL is how long a NOT_FOUND is remembered, defaults to 5 seconds, a negative value disables it
+	NegativeTTL time.Duration
+	// Prefixes limits the cache to the keys starting with one of them, all keys are cached if empty
+	Prefixes []string
+	// Channel is where writes are broadcast to the other replicas, defaults to cache:invalidate
+	Channel string
+}
+
+// CachedStore is a RedisStore keeping the values of Get and HGetAll in memory.
+// Writes through Set, SetNX, MSet, Delete, HSet, HDel, Expire, Persist and the counters
+// drop the key here and, through Listen, in the other replicas. Writes made any other
+// way, e.g. by a lua script, must be followed by Invalidate.
+type CachedStore struct {
+	RedisStore
+	cache   *localCache
+	options CacheOptions
+	// bypass is set on the stores handed to pipelines and Watch, whose reads must go to redis
+	bypass bool
+	// pending collects the keys written by a pipeline, they are invalidated once it ran
+	pending *pendingKeys
+}
+
+type pendingKeys struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (p *pendingKeys) add(keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, keys...)
+}
+
+func NewCachedStore(store RedisStore, options CacheOptions) *CachedStore {
+	if options.Size == 0 {
+		options.Size = 10000
+	}
+	if options.TTL == 0 {
+		options.TTL = time.Minute
+	}
+	if options.NegativeTTL == 0 {
+		options.NegativeTTL = 5 * time.Second
+	}
+	if options.Channel == "" {
+		options.Channel = "cache:invalidate"
+	}
+	return &CachedStore{
+		RedisStore: store,
+		cache:      newLocalCache(options.Size),
+		options:    options,
+	}
+}
+
+func (s *CachedStore) WithContext(ctx context.Context) RedisStore {
+	bound := *s
+	bound.RedisStore = s.RedisStore.WithContext(ctx)
+	return &bound
+}
+
+func (s *CachedStore) cached(key string) bool {
+	return !s.bypass && s.matches(key)
+}
+
+func (s *CachedStore) matches(key string) bool {
+	if len(s.options.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range s.options.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// remember caches value, or NOT_FOUND if err is one, unless something was invalidated
+// since version was read as the value may have been fetched before the write
+func (s *CachedStore) remember(version uint64, key string, value interface{}, err error) {
+	if err == nil {
+		s.cache.set(version, key, value, s.options.TTL)
+	} else if serror.Is(err, serror.NOT_FOUND) && s.options.NegativeTTL > 0 {
+		s.cache.set(version, key, nil, s.options.NegativeTTL)
+	}
+}
+
+func (s *CachedStore) Get(key string) ([]byte, error) {
+	if !s.cached(key) {
+		return s.RedisStore.Get(key)
+	}
+	if value, ok := s.cache.get(key); ok {
+		if value == nil {
+			return nil, common.StringError(serror.NOT_FOUND)
+		}
+		if bytes, ok := value.([]byte); ok {
+			return append([]byte{}, bytes...), nil
+		}
+	}
+
+	version := s.cache.currentVersion()
+	bytes, err := s.RedisStore.Get(key)
+	s.remember(version, key, append([]byte{}, bytes...), err)
+	return bytes, err
+}
+
+func (s *CachedStore) HGetAll(key string) (map[string]string, error) {
+	if !s.cached(key) {
+		return s.RedisStore.HGetAll(key)
+	}
+	if value, ok := s.cache.get(key); ok {
+		if value == nil {
+			return nil, common.StringError(serror.NOT_FOUND)
+		}
+		if hash, ok := value.(map[string]string); ok {
+			return copyHash(hash), nil
+		}
+	}
+
+	version := s.cache.currentVersion()
+	hash, err := s.RedisStore.HGetAll(key)
+	s.remember(version, key, copyHash(hash), err)
+	return hash, err
+}
+
+func copyHash(hash map[string]string) map[string]string {
+	copied := make(map[string]string, len(hash))
+	for field, value := range hash {
+		copied[field] = value
+	}
+	return copied
+}
+
+// Invalidate drops the keys from the memory of every replica. Called within a pipeline,
+// it waits for the pipeline to run.
+func (s *CachedStore) Invalidate(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if s.pending != nil {
+		s.pending.add(keys...)
+		return nil
+	}
+
+	for _, key := range keys {
+		s.cache.delete(key)
+	}
+	// one round trip for the whole batch
+	err := s.RedisStore.Pipelined(func(pipe RedisStore) error {
+		for _, key := range keys {
+			if err := pipe.Publish(s.options.Channel, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return common.StringError(err)
+}
+
+// InvalidateAll clears the memory of every replica
+func (s *CachedStore) InvalidateAll() error {
+	s.cache.clear()
+	return common.StringError(s.RedisStore.Publish(s.options.Channel, invalidateAll))
+}
+
+// invalidate drops the cached keys after a write, on error too since the write may have gone through
+func (s *CachedStore) invalidate(err error, keys ...string) error {
+	matching := []string{}
+	for _, key := range keys {
+		if s.matches(key) {
+			matching = append(matching, key)
+		}
+	}
+	if invalidateErr := s.Invalidate(matching...); invalidateErr != nil && err == nil {
+		return common.StringError(invalidateErr)
+	}
+	return err
+}
+
+// Listen applies the invalidations broadcast by the other replicas until ctx is done.
+// Everything is dropped whenever the subscription is (re)established since
+// invalidations may have been missed while it was down.
+func (s *CachedStore) Listen(ctx context.Context) error {
+	for ctx.Err() == nil {
+		subscription, err := s.RedisStore.Subscribe(ctx, s.options.Channel)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Str("channel", s.options.Channel).Msg("failed to subscribe to cache invalidations")
+			}
+			s.cache.clear()
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		s.cache.clear()
+		for message := range subscription.Messages() {
+			if message.Payload == invalidateAll {
+				s.cache.clear()
+			} else {
+				s.cache.delete(message.Payload)
+			}
+		}
+		subscription.Close()
+	}
+	return nil
+}
+
+func (s *CachedStore) Set(key string, value any, expire time.Duration) error {
+	return s.invalidate(s.RedisStore.Set(key, value, expire), key)
+}
+
+func (s *CachedStore) SetNX(key string, value any, expire time.Duration) (bool, error) {
+	ok, err := s.RedisStore.SetNX(key, value, expire)
+	return ok, s.invalidate(err, key)
+}
+
+func (s *CachedStore) MSet(values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	return s.invalidate(s.RedisStore.MSet(values), keys...)
+}
+
+func (s *CachedStore) Delete(key string) error {
+	return s.invalidate(s.RedisStore.Delete(key), key)
+}
+
+func (s *CachedStore) HSet(key string, data map[string]interface{}) error {
+	return s.invalidate(s.RedisStore.HSet(key, data), key)
+}
+
+func (s *CachedStore) HDel(key string, fields ...string) (int64, error) {
+	deleted, err := s.RedisStore.HDel(key, fields...)
+	return deleted, s.invalidate(err, key)
+}
+
+func (s *CachedStore) Expire(key string, expire time.Duration) error {
+	return s.invalidate(s.RedisStore.Expire(key, expire), key)
+}
+
+func (s *CachedStore) Persist(key string) error {
+	return s.invalidate(s.RedisStore.Persist(key), key)
+}
+
+func (s *CachedStore) Incr(key string) (int64, error) {
+	value, err := s.RedisStore.Incr(key)
+	return value, s.invalidate(err, key)
+}
+
+func (s *CachedStore) IncrBy(key string, increment int64) (int64, error) {
+	value, err := s.RedisStore.IncrBy(key, increment)
+	return value, s.invalidate(err, key)
+}
+
+func (s *CachedStore) Decr(key string) (int64, error) {
+	value, err := s.RedisStore.Decr(key)
+	return value, s.invalidate(err, key)
+}
+
+func (s *CachedStore) DecrBy(key string, decrement int64) (int64, error) {
+	value, err := s.RedisStore.DecrBy(key, decrement)
+	return value, s.invalidate(err, key)
+}
+
+// piped runs fn on a store whose writes are invalidated once run returns, dropping the keys
+// before the commands reach redis would let a concurrent Get cache the old values again
+func (s *CachedStore) piped(run func(func(RedisStore) error) error, fn func(RedisStore) error) error {
+	pending := s.pending
+	if pending == nil {
+		pending = &pendingKeys{}
+	}
+	err := run(func(store RedisStore) error {
+		piped := *s
+		piped.RedisStore = store
+		// reads must go to redis, e.g. to see the watched keys as they are
+		piped.bypass = true
+		piped.pending = pending
+		return fn(&piped)
+	})
+	if s.pending != nil {
+		// nested in another pipeline, which invalidates when it is done
+		return err
+	}
+	// on error too since some writes may have gone through
+	return s.invalidate(err, pending.keys...)
+}
+
+func (s *CachedStore) Pipelined(fn func(pipe RedisStore) error) error {
+	return s.piped(s.RedisStore.Pipelined, fn)
+}
+
+func (s *CachedStore) TxPipelined(fn func(pipe RedisStore) error) error {
+	return s.piped(s.RedisStore.TxPipelined, fn)
+}
+
+func (s *CachedStore) Watch(fn func(tx RedisStore) error, keys ...string) error {
+	return s.piped(func(fn func(RedisStore) error) error {
+		return s.RedisStore.Watch(fn, keys...)
+	}, fn)
+}
+
+// localCache is an LRU whose entries also expire, a nil value is a cached NOT_FOUND
+type localCache struct {
+	mu   sync.Mutex
+	size int
+	// version is bumped on every invalidation
+	version uint64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type localCacheEntry struct {
+	key      string
+	value    interface{}
+	expireAt time.Time
+}
+
+func newLocalCache(size int) *localCache {
+	return &localCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *localCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*localCacheEntry)
+	if time.Now().After(entry.expireAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *localCache) currentVersion() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+func (c *localCache) set(version uint64, key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	entry := &localCacheEntry{key: key, value: value, expireAt: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*localCacheEntry).key)
+	}
+}
+
+func (c *localCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+func (c *localCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
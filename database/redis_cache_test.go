@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedStore(t *testing.T) {
+	redis := NewMemoryRedisStore()
+	store := NewCachedStore(redis, CacheOptions{Prefixes: []string{"config:"}})
+
+	redis.Set("config:a", "1", 0)
+	value, err := store.Get("config:a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	// served from memory until invalidated
+	redis.Set("config:a", "2", 0)
+	value, _ = store.Get("config:a")
+	assert.Equal(t, []byte("1"), value)
+	assert.NoError(t, store.Set("config:a", "3", 0))
+	value, _ = store.Get("config:a")
+	assert.Equal(t, []byte("3"), value)
+
+	// NOT_FOUND is cached too
+	_, err = store.Get("config:b")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	redis.Set("config:b", "1", 0)
+	_, err = store.Get("config:b")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+	// keys outside the prefixes always go to redis
+	redis.Set("other", "1", 0)
+	store.Get("other")
+	redis.Set("other", "2", 0)
+	value, _ = store.Get("other")
+	assert.Equal(t, []byte("2"), value)
+}
+
+func TestCachedStoreEviction(t *testing.T) {
+	redis := NewMemoryRedisStore()
+	store := NewCachedStore(redis, CacheOptions{Size: 1, TTL: 50 * time.Millisecond})
+
+	redis.Set("a", "1", 0)
+	redis.Set("b", "1", 0)
+	store.Get("a")
+	store.Get("b")
+	redis.Set("a", "2", 0)
+	redis.Set("b", "2", 0)
+
+	// a was evicted by b, b expires
+	value, _ := store.Get("a")
+	assert.Equal(t, []byte("2"), value)
+	time.Sleep(60 * time.Millisecond)
+	value, _ = store.Get("b")
+	assert.Equal(t, []byte("2"), value)
+}
+
+func TestCachedStoreInvalidation(t *testing.T) {
+	redis := NewMemoryRedisStore()
+	replica := NewCachedStore(redis, CacheOptions{})
+	other := NewCachedStore(redis, CacheOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replica.Listen(ctx)
+
+	redis.HSet("hash", map[string]interface{}{"a": "1"})
+	hash, err := replica.HGetAll("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, hash)
+
+	assert.Eventually(t, func() bool {
+		other.HSet("hash", map[string]interface{}{"a": "2"})
+		hash, _ := replica.HGetAll("hash")
+		return hash["a"] == "2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCachedStorePipelined(t *testing.T) {
+	redis, _ := newMiniRedisStore(t)
+	store := NewCachedStore(redis, CacheOptions{})
+
+	redis.Set("a", "1", 0)
+	redis.Set("b", "1", 0)
+	store.Get("a")
+	store.Get("b")
+
+	err := store.Pipelined(func(pipe RedisStore) error {
+		pipe.Set("a", "2", 0)
+		pipe.Set("b", "2", 0)
+		// a read racing the pipeline sees the old value, which must not outlive it
+		value, _ := store.Get("a")
+		assert.Equal(t, []byte("1"), value)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for _, key := range []string{"a", "b"} {
+		value, _ := store.Get(key)
+		assert.Equal(t, []byte("2"), value)
+	}
+
+	err = store.Watch(func(tx RedisStore) error {
+		return tx.TxPipelined(func(pipe RedisStore) error {
+			return pipe.Set("a", "3", 0)
+		})
+	}, "a")
+	assert.NoError(t, err)
+	value, _ := store.Get("a")
+	assert.Equal(t, []byte("3"), value)
+}
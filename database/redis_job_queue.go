@@ -0,0 +1,468 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const jobQueuePrefix = "jobs:"
+
+// how long settling a job may take once its handler returned
+const jobSettleTimeout = 5 * time.Second
+
+var errNoJob = errors.New("no job ready")
+
+// moves up to ARGV[2] members of the sorted set KEYS[1] whose score is due at ARGV[1]
+// to the list KEYS[2], for scheduled jobs
+var promoteJobsScript = redis.NewScript(`
+local ids = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "limit", 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call("zrem", KEYS[1], id)
+	redis.call("lpush", KEYS[2], id)
+end
+return #ids
+`)
+
+// pops the next ready job id from KEYS[1], counts the attempt in the hash KEYS[4] and keeps
+// the job in flight until ARGV[1]: the delivery "<job id>:<ARGV[2]>" is added to the sorted
+// set KEYS[2] and mapped to the job id in the hash KEYS[3]. Replies with the delivery, the job
+// from the hash KEYS[5], its attempts and its max attempts from the hash KEYS[6].
+var dequeueJobScript = redis.NewScript(`
+local id = redis.call("rpop", KEYS[1])
+if not id then
+	return false
+end
+local delivery = id .. ":" .. ARGV[2]
+local attempts = redis.call("hincrby", KEYS[4], id, 1)
+redis.call("zadd", KEYS[2], ARGV[1], delivery)
+redis.call("hset", KEYS[3], delivery, id)
+local job = redis.call("hget", KEYS[5], id) or ""
+local maxAttempts = tonumber(redis.call("hget", KEYS[6], id) or "0")
+return {delivery, job, attempts, maxAttempts}
+`)
+
+// moves up to ARGV[2] deliveries of the sorted set KEYS[1] whose visibility timed out at ARGV[1]
+// back to the list KEYS[3], or to the sorted set KEYS[4] if it was the last attempt of the job,
+// as counted in the hashes KEYS[5] and KEYS[6]
+var requeueJobsScript = redis.NewScript(`
+local deliveries = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "limit", 0, ARGV[2])
+for _, delivery in ipairs(deliveries) do
+	redis.call("zrem", KEYS[1], delivery)
+	local id = redis.call("hget", KEYS[2], delivery)
+	redis.call("hdel", KEYS[2], delivery)
+	if id then
+		local attempts = tonumber(redis.call("hget", KEYS[5], id) or "0")
+		local maxAttempts = tonumber(redis.call("hget", KEYS[6], id) or "0")
+		if attempts >= maxAttempts then
+			redis.call("zadd", KEYS[4], ARGV[1], id)
+		else
+			redis.call("lpush", KEYS[3], id)
+		end
+	end
+end
+return #deliveries
+`)
+
+// ends the delivery ARGV[1] if it is still in flight in KEYS[1] and KEYS[2]. With a job ARGV[3]
+// it is stored in the hash KEYS[4] and its id added to the sorted set KEYS[3] with the score
+// ARGV[2], without one the job is done and removed from the hashes KEYS[4], KEYS[5] and KEYS[6].
+var settleJobScript = redis.NewScript(`
+if redis.call("zrem", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+local id = redis.call("hget", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+if not id then
+	return 1
+end
+if ARGV[3] ~= "" then
+	redis.call("hset", KEYS[4], id, ARGV[3])
+	redis.call("zadd", KEYS[3], ARGV[2], id)
+else
+	redis.call("hdel", KEYS[4], id)
+	redis.call("hdel", KEYS[5], id)
+	redis.call("hdel", KEYS[6], id)
+end
+return 1
+`)
+
+// Job is what the queue stores, its attempts are counted apart from it
+type Job struct {
+	Id        string          `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	LastError string          `json:"lastError,omitempty"`
+	// Attempts counts the runs of the job, the current one included
+	Attempts    int `json:"-"`
+	MaxAttempts int `json:"-"`
+}
+
+// JobHandler processes a job, returning an error schedules a retry
+type JobHandler func(ctx context.Context, job *Job) error
+
+// HandleJob adapts a handler receiving the decoded payload of the job
+func HandleJob[T any](handler func(ctx context.Context, payload T) error) JobHandler {
+	return func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return common.StringError(err)
+		}
+		return handler(ctx, payload)
+	}
+}
+
+type JobQueueOptions struct {
+	// Workers is how many jobs are processed concurrently, defaults to 10
+	Workers int
+	// MaxAttempts before a job goes to the dead letter set, defaults to 5
+	MaxAttempts int
+	// BaseBackoff is doubled on every retry, defaults to 5 seconds
+	BaseBackoff time.Duration
+	// MaxBackoff caps the delay between retries, defaults to 1 hour
+	MaxBackoff time.Duration
+	// VisibilityTimeout is how long a job may run before it is handed to another worker, defaults to 5 minutes
+	VisibilityTimeout time.Duration
+	// PollInterval is how often an idle worker looks for jobs, defaults to 1 second
+	PollInterval time.Duration
+}
+
+// JobQueue is a durable queue of jobs kept in redis:
+//   - jobs:{<name>}:jobs is a hash of the jobs by id
+//   - jobs:{<name>}:attempts and jobs:{<name>}:maxAttempts are hashes of the attempts of the jobs by id
+//   - jobs:{<name>}:ready is the list of the ids of the jobs ready to run
+//   - jobs:{<name>}:scheduled is a sorted set of job ids by the time they should run
+//   - jobs:{<name>}:inflight is a sorted set of deliveries, "<job id>:<token>", by their visibility deadline
+//   - jobs:{<name>}:deliveries is a hash of the ids of the running jobs by delivery
+//   - jobs:{<name>}:dead is a sorted set of the ids of the jobs out of attempts by the time they failed
+//
+// The braces keep all the keys of a queue in the same cluster hash slot.
+// A job whose worker dies or overruns goes back to ready once its visibility timeout
+// expires, which counts as a failed attempt, so handlers must be idempotent.
+// A worker only settles its own delivery, a late one can't settle the next run of the job.
+type JobQueue struct {
+	store    RedisStore
+	name     string
+	options  JobQueueOptions
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+func NewJobQueue(store RedisStore, name string, options JobQueueOptions) *JobQueue {
+	if options.Workers == 0 {
+		options.Workers = 10
+	}
+	if options.MaxAttempts == 0 {
+		options.MaxAttempts = 5
+	}
+	if options.BaseBackoff == 0 {
+		options.BaseBackoff = 5 * time.Second
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = time.Hour
+	}
+	if options.VisibilityTimeout == 0 {
+		options.VisibilityTimeout = 5 * time.Minute
+	}
+	if options.PollInterval == 0 {
+		options.PollInterval = time.Second
+	}
+	return &JobQueue{
+		store:    store,
+		name:     name,
+		options:  options,
+		handlers: map[string]JobHandler{},
+	}
+}
+
+// Register sets the handler of a job type, jobs without a handler are retried
+func (q *JobQueue) Register(jobType string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Enqueue adds a job that runs as soon as a worker is free
+func (q *JobQueue) Enqueue(ctx context.Context, jobType string, payload any) (*Job, error) {
+	return q.Schedule(ctx, jobType, payload, time.Time{})
+}
+
+// Schedule adds a job that runs at runAt, or right away if runAt is zero or past
+func (q *JobQueue) Schedule(ctx context.Context, jobType string, payload any, runAt time.Time) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	id, err := common.RandomToken(16)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	job := &Job{
+		Id:          id,
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: q.options.MaxAttempts,
+		CreatedAt:   time.Now(),
+	}
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	// the job is stored before its id is queued so a worker never pops an id without its job
+	err = q.store.WithContext(ctx).TxPipelined(func(pipe RedisStore) error {
+		if err := pipe.HSet(q.key("jobs"), map[string]interface{}{id: string(encoded)}); err != nil {
+			return err
+		}
+		if err := pipe.HSet(q.key("maxAttempts"), map[string]interface{}{id: job.MaxAttempts}); err != nil {
+			return err
+		}
+		var err error
+		if runAt.After(time.Now()) {
+			_, err = pipe.ZAdd(q.key("scheduled"), &redis.Z{Score: float64(runAt.UnixMilli()), Member: id})
+		} else {
+			_, err = pipe.LPush(q.key("ready"), id)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	return job, nil
+}
+
+// Dead returns up to count jobs that ran out of attempts, oldest first
+func (q *JobQueue) Dead(ctx context.Context, count int64) ([]*Job, error) {
+	store := q.store.WithContext(ctx)
+	ids, err := store.ZRangeByScore(q.key("dead"), &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: count})
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	jobs := []*Job{}
+	if len(ids) == 0 {
+		return jobs, nil
+	}
+
+	encoded, err := store.HMGet(q.key("jobs"), ids...)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	attempts, err := store.HMGet(q.key("attempts"), ids...)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	maxAttempts, err := store.HMGet(q.key("maxAttempts"), ids...)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	for _, id := range ids {
+		data, ok := encoded[id]
+		if !ok {
+			continue
+		}
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, common.StringError(err)
+		}
+		job.Attempts, _ = strconv.Atoi(string(attempts[id]))
+		job.MaxAttempts, _ = strconv.Atoi(string(maxAttempts[id]))
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Run processes jobs with Workers goroutines until ctx is done, then waits for the
+// running jobs to finish and returns nil. It returns an error right away if the jobs
+// can't be promoted when it starts, once running the workers log and retry on errors.
+func (q *JobQueue) Run(ctx context.Context) error {
+	if err := q.promote(ctx); err != nil {
+		return common.StringError(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < q.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := q.promote(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Str("queue", q.name).Msg("failed to promote jobs")
+		}
+
+		delivery, raw, attempts, err := q.dequeue(ctx)
+		if err != nil {
+			if !errors.Is(err, errNoJob) && ctx.Err() == nil {
+				log.Error().Err(err).Str("queue", q.name).Msg("failed to dequeue job")
+			}
+			sleep(ctx, q.options.PollInterval)
+			continue
+		}
+
+		q.process(delivery, raw, attempts)
+	}
+}
+
+// promote moves due scheduled jobs and timed out jobs back to ready
+func (q *JobQueue) promote(ctx context.Context) error {
+	store := q.store.WithContext(ctx)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if _, err := store.Eval(promoteJobsScript, []string{q.key("scheduled"), q.key("ready")}, now, 100); err != nil {
+		return common.StringError(err)
+	}
+	keys := []string{q.key("inflight"), q.key("deliveries"), q.key("ready"), q.key("dead"), q.key("attempts"), q.key("maxAttempts")}
+	if _, err := store.Eval(requeueJobsScript, keys, now, 100); err != nil {
+		return common.StringError(err)
+	}
+	return nil
+}
+
+// jobAttempts is how many times a job ran, the current run included, out of its max
+type jobAttempts struct {
+	attempts    int
+	maxAttempts int
+}
+
+// dequeue returns the delivery, the job and its attempts
+func (q *JobQueue) dequeue(ctx context.Context) (string, string, jobAttempts, error) {
+	token, err := common.RandomToken(8)
+	if err != nil {
+		return "", "", jobAttempts{}, common.StringError(err)
+	}
+	deadline := time.Now().Add(q.options.VisibilityTimeout).UnixMilli()
+	keys := []string{q.key("ready"), q.key("inflight"), q.key("deliveries"), q.key("attempts"), q.key("jobs"), q.key("maxAttempts")}
+	result, err := q.store.WithContext(ctx).Eval(dequeueJobScript, keys, deadline, token)
+	if err != nil {
+		// the false lua reply reads as nil
+		if serror.Is(err, serror.NOT_FOUND) {
+			return "", "", jobAttempts{}, errNoJob
+		}
+		return "", "", jobAttempts{}, common.StringError(err)
+	}
+
+	reply, ok := result.([]interface{})
+	if !ok || len(reply) != 4 {
+		return "", "", jobAttempts{}, common.StringError(errors.Errorf("unexpected dequeue job reply %v", result))
+	}
+	delivery, ok1 := reply[0].(string)
+	raw, ok2 := reply[1].(string)
+	attempts, ok3 := reply[2].(int64)
+	maxAttempts, ok4 := reply[3].(int64)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return "", "", jobAttempts{}, common.StringError(errors.Errorf("unexpected dequeue job reply %v", result))
+	}
+	return delivery, raw, jobAttempts{int(attempts), int(maxAttempts)}, nil
+}
+
+// process runs the job and settles it, it is not bound to the worker context
+// so a job started before shutdown is settled once it finishes
+func (q *JobQueue) process(delivery string, raw string, attempts jobAttempts) {
+	job := &Job{}
+	if err := json.Unmarshal([]byte(raw), job); err != nil {
+		log.Error().Err(err).Str("queue", q.name).Msg("dropping malformed job")
+		q.settle(delivery, "", "", time.Time{}, "")
+		return
+	}
+	job.Attempts, job.MaxAttempts = attempts.attempts, attempts.maxAttempts
+
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = errors.New("no handler registered for job type " + job.Type)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), q.options.VisibilityTimeout)
+		err = handler(ctx, job)
+		cancel()
+	}
+	if err == nil {
+		q.settle(delivery, job.Id, "", time.Time{}, "")
+		return
+	}
+
+	// the attempt was counted when the job was dequeued
+	job.LastError = err.Error()
+	encoded, marshalErr := json.Marshal(job)
+	if marshalErr != nil {
+		// retry the job as it was dequeued rather than leave it to the visibility timeout
+		log.Error().Err(marshalErr).Str("queue", q.name).Str("job", job.Id).Msg("failed to record the job error")
+		encoded = []byte(raw)
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		if q.settle(delivery, job.Id, "dead", time.Now(), string(encoded)) {
+			log.Error().Err(err).Str("queue", q.name).Str("job", job.Id).Int("attempts", job.Attempts).Msg("job moved to dead letter set")
+		}
+		return
+	}
+	runAt := time.Now().Add(q.backoff(job.Attempts))
+	if q.settle(delivery, job.Id, "scheduled", runAt, string(encoded)) {
+		log.Warn().Err(err).Str("queue", q.name).Str("job", job.Id).Int("attempts", job.Attempts).Msg("job failed, retrying")
+	}
+}
+
+// settle ends the delivery, storing job and moving its id to the set scored by at, or
+// dropping the job without a set. It reports whether the delivery was still ours, it is
+// not once its visibility timed out. It uses its own context as the handler may have
+// used all of the visibility timeout.
+func (q *JobQueue) settle(delivery string, jobId string, set string, at time.Time, job string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), jobSettleTimeout)
+	defer cancel()
+
+	target := q.key("scheduled")
+	if set != "" {
+		target = q.key(set)
+	}
+	keys := []string{q.key("inflight"), q.key("deliveries"), target, q.key("jobs"), q.key("attempts"), q.key("maxAttempts")}
+	result, err := q.store.WithContext(ctx).Eval(settleJobScript, keys, delivery, at.UnixMilli(), job)
+	if err != nil {
+		log.Error().Err(err).Str("queue", q.name).Str("job", jobId).Msg("failed to settle job")
+		return false
+	}
+	settled, ok := result.(int64)
+	if !ok {
+		log.Error().Str("queue", q.name).Str("job", jobId).Msgf("unexpected settle job reply %v", result)
+		return false
+	}
+	if settled == 0 {
+		// the visibility timeout expired and the job was handed to another worker
+		log.Warn().Str("queue", q.name).Str("job", jobId).Msg("job settled after its visibility timeout")
+		return false
+	}
+	return true
+}
+
+// backoff doubles BaseBackoff for every attempt, capped at MaxBackoff
+func (q *JobQueue) backoff(attempts int) time.Duration {
+	backoff := float64(q.options.BaseBackoff) * math.Pow(2, float64(attempts-1))
+	if backoff > float64(q.options.MaxBackoff) {
+		return q.options.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+func (q *JobQueue) key(name string) string {
+	return jobQueuePrefix + "{" + q.name + "}:" + name
+}
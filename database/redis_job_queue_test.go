@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/stretchr/testify/assert"
+)
+
+// runJobQueue runs the queue with handler for the "test" jobs until the test ends
+func runJobQueue(t *testing.T, store RedisStore, options JobQueueOptions, handler JobHandler) *JobQueue {
+	options.PollInterval = 5 * time.Millisecond
+	queue := NewJobQueue(store, "test", options)
+	queue.Register("test", handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, queue.Run(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return queue
+}
+
+func jobQueueStores(t *testing.T) map[string]RedisStore {
+	redisStore, _ := newMiniRedisStore(t)
+	return map[string]RedisStore{"redis": redisStore, "memory": NewMemoryRedisStore()}
+}
+
+func TestJobQueueRetry(t *testing.T) {
+	for name, store := range jobQueueStores(t) {
+		t.Run(name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			attempts := []int{}
+			runs := []time.Time{}
+			queue := runJobQueue(t, store, JobQueueOptions{Workers: 1, MaxAttempts: 3, BaseBackoff: 20 * time.Millisecond}, func(ctx context.Context, job *Job) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts = append(attempts, job.Attempts)
+				runs = append(runs, time.Now())
+				if job.Attempts < 3 {
+					return errors.New("not yet")
+				}
+				return nil
+			})
+
+			_, err := queue.Enqueue(context.Background(), "test", map[string]string{"id": "1"})
+			assert.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				count, err := store.ZCard(queue.key("inflight"))
+				mu.Lock()
+				defer mu.Unlock()
+				return err == nil && count == 0 && len(attempts) == 3
+			}, 5*time.Second, 5*time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, []int{1, 2, 3}, attempts)
+			// the backoff doubles on every retry, run times are kept to the millisecond
+			assert.GreaterOrEqual(t, runs[1].Sub(runs[0]), 19*time.Millisecond)
+			assert.GreaterOrEqual(t, runs[2].Sub(runs[1]), 39*time.Millisecond)
+			dead, err := queue.Dead(context.Background(), 10)
+			assert.NoError(t, err)
+			assert.Empty(t, dead)
+			// a done job leaves nothing behind
+			for _, key := range []string{"jobs", "attempts", "maxAttempts"} {
+				_, err = store.HMLen(queue.key(key))
+				assert.True(t, serror.Is(err, serror.NOT_FOUND), key)
+			}
+		})
+	}
+}
+
+func TestJobQueueRunError(t *testing.T) {
+	store, mini := newMiniRedisStore(t)
+	mini.Close()
+
+	queue := NewJobQueue(store, "test", JobQueueOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Error(t, queue.Run(ctx))
+}
+
+func TestJobQueueDeadLetter(t *testing.T) {
+	for name, store := range jobQueueStores(t) {
+		t.Run(name, func(t *testing.T) {
+			queue := runJobQueue(t, store, JobQueueOptions{Workers: 1, MaxAttempts: 2, BaseBackoff: time.Millisecond}, func(ctx context.Context, job *Job) error {
+				return errors.New("payment declined")
+			})
+
+			job, err := queue.Enqueue(context.Background(), "test", nil)
+			assert.NoError(t, err)
+			var dead []*Job
+			assert.Eventually(t, func() bool {
+				dead, err = queue.Dead(context.Background(), 10)
+				return err == nil && len(dead) == 1
+			}, 5*time.Second, 5*time.Millisecond)
+
+			assert.Equal(t, job.Id, dead[0].Id)
+			assert.Equal(t, 2, dead[0].Attempts)
+			assert.Equal(t, "payment declined", dead[0].LastError)
+		})
+	}
+}
+
+func TestJobQueueVisibilityTimeout(t *testing.T) {
+	for name, store := range jobQueueStores(t) {
+		t.Run(name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			attempts := []int{}
+			// overrunning counts as a failed attempt
+			queue := runJobQueue(t, store, JobQueueOptions{Workers: 3, MaxAttempts: 2, VisibilityTimeout: 30 * time.Millisecond}, func(ctx context.Context, job *Job) error {
+				mu.Lock()
+				attempts = append(attempts, job.Attempts)
+				mu.Unlock()
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			})
+
+			_, err := queue.Enqueue(context.Background(), "test", nil)
+			assert.NoError(t, err)
+			var dead []*Job
+			assert.Eventually(t, func() bool {
+				dead, err = queue.Dead(context.Background(), 10)
+				return err == nil && len(dead) == 1
+			}, 5*time.Second, 5*time.Millisecond)
+			assert.Equal(t, 2, dead[0].Attempts)
+
+			// the late runs don't bring the job back
+			time.Sleep(150 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, []int{1, 2}, attempts)
+			count, err := store.ZCard(queue.key("inflight"))
+			assert.NoError(t, err)
+			assert.Zero(t, count)
+		})
+	}
+}
+
+func TestJobQueueLateSettle(t *testing.T) {
+	for name, store := range jobQueueStores(t) {
+		t.Run(name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			attempts := []int{}
+			firstDone := make(chan struct{})
+			var queue *JobQueue
+			queue = runJobQueue(t, store, JobQueueOptions{Workers: 2, MaxAttempts: 3, VisibilityTimeout: 100 * time.Millisecond}, func(ctx context.Context, job *Job) error {
+				mu.Lock()
+				attempts = append(attempts, job.Attempts)
+				mu.Unlock()
+				if job.Attempts == 1 {
+					defer close(firstDone)
+					time.Sleep(150 * time.Millisecond)
+					return nil
+				}
+
+				// the first run finished late and must not have settled this one
+				<-firstDone
+				time.Sleep(20 * time.Millisecond)
+				count, err := store.ZCard(queue.key("inflight"))
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), count)
+				return nil
+			})
+
+			_, err := queue.Enqueue(context.Background(), "test", nil)
+			assert.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				count, err := store.ZCard(queue.key("inflight"))
+				mu.Lock()
+				defer mu.Unlock()
+				return err == nil && count == 0 && len(attempts) == 2
+			}, 5*time.Second, 5*time.Millisecond)
+
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, []int{1, 2}, attempts)
+			_, err = store.HMLen(queue.key("deliveries"))
+			assert.True(t, serror.Is(err, serror.NOT_FOUND))
+		})
+	}
+}
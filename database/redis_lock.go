@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const redisLockPrefix = "lock:"
+
+// how long Acquire waits between two attempts
+const redisLockRetryInterval = 50 * time.Millisecond
+
+// only delete the key if it still holds our token, otherwise the lock
+// expired and was taken by someone else in the meantime
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+var extendLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// RedisLock is a mutex shared across replicas through a single redis key.
+// The key holds a random token, so only the holder can release or extend it,
+// and it expires after ttl in case the holder dies without releasing it.
+type RedisLock struct {
+	store RedisStore
+	key   string
+	ttl   time.Duration
+	mu    sync.Mutex
+	token string
+}
+
+// validLockTTL rejects ttls redis cannot expire a key with, a lock that never
+// expires would be held forever by a dead holder
+func validLockTTL(ttl time.Duration) error {
+	if ttl < time.Millisecond {
+		return common.StringError(serror.INVALID_DATA, "lock ttl must be at least 1ms, got "+ttl.String())
+	}
+	return nil
+}
+
+// NewRedisLock locks key for ttl, which must be at least 1ms
+func NewRedisLock(store RedisStore, key string, ttl time.Duration) *RedisLock {
+	return &RedisLock{
+		store: store,
+		key:   redisLockPrefix + key,
+		ttl:   ttl,
+	}
+}
+
+// Key returns the redis key backing the lock
+func (l *RedisLock) Key() string {
+	return l.key
+}
+
+// Token returns the token of the current holder, empty if the lock is not held
+func (l *RedisLock) Token() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// TryAcquire makes a single attempt to take the lock with SET NX PX
+func (l *RedisLock) TryAcquire(ctx context.Context) (bool, error) {
+	if err := validLockTTL(l.ttl); err != nil {
+		return false, err
+	}
+	token, err := common.RandomToken(16)
+	if err != nil {
+		return false, common.StringError(err)
+	}
+
+	ok, err := l.store.WithContext(ctx).SetNX(l.key, token, l.ttl)
+	if err != nil {
+		return false, common.StringError(err)
+	}
+	if ok {
+		l.mu.Lock()
+		l.token = token
+		l.mu.Unlock()
+	}
+	return ok, nil
+}
+
+// Acquire blocks until the lock is taken, the timeout elapses or ctx is done.
+// A timeout of zero waits for as long as ctx allows. If ctx is done the error
+// wraps ctx.Err(), so errors.Is(err, context.Canceled) works.
+func (l *RedisLock) Acquire(ctx context.Context, timeout time.Duration) error {
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(redisLockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := l.TryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			return common.StringError(err)
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if timeout > 0 && parent.Err() == nil {
+				return common.StringError(serror.LOCK_NOT_ACQUIRED, l.key)
+			}
+			// common.StringError would hide the context error from errors.Is
+			return errors.Wrap(parent.Err(), "acquiring "+l.key)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Release frees the lock if it is still held by this instance
+func (l *RedisLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.token == "" {
+		return common.StringError(serror.LOCK_NOT_HELD, l.key)
+	}
+
+	result, err := l.store.WithContext(ctx).Eval(releaseLockScript, []string{l.key}, l.token)
+	l.token = ""
+	if err != nil {
+		return common.StringError(err)
+	}
+	released, ok := result.(int64)
+	if !ok {
+		return common.StringError(errors.Errorf("unexpected release lock reply %v", result))
+	}
+	if released == 0 {
+		return common.StringError(serror.LOCK_NOT_HELD, l.key)
+	}
+	return nil
+}
+
+// Extend resets the expiration of the lock to ttl, which must be at least 1ms, if it is
+// still held by this instance
+func (l *RedisLock) Extend(ctx context.Context, ttl time.Duration) error {
+	if err := validLockTTL(ttl); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.token == "" {
+		return common.StringError(serror.LOCK_NOT_HELD, l.key)
+	}
+
+	result, err := l.store.WithContext(ctx).Eval(extendLockScript, []string{l.key}, l.token, ttl.Milliseconds())
+	if err != nil {
+		return common.StringError(err)
+	}
+	extended, ok := result.(int64)
+	if !ok {
+		return common.StringError(errors.Errorf("unexpected extend lock reply %v", result))
+	}
+	if extended == 0 {
+		l.token = ""
+		return common.StringError(serror.LOCK_NOT_HELD, l.key)
+	}
+	return nil
+}
+
+// WithRedisLock runs fn while holding the lock on key, extending it every ttl/2
+// for as long as fn runs. The context given to fn is cancelled if the lock is lost.
+func WithRedisLock(ctx context.Context, store RedisStore, key string, ttl time.Duration, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if err := validLockTTL(ttl); err != nil {
+		return err
+	}
+	lock := NewRedisLock(store, key, ttl)
+	if err := lock.Acquire(ctx, timeout); err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lock.Extend(fnCtx, ttl); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(fnCtx)
+	close(done)
+
+	// the lock may already be gone if renewal failed, fn's error matters more
+	releaseErr := lock.Release(context.Background())
+	if err != nil {
+		return err
+	}
+	if releaseErr != nil {
+		return common.StringError(releaseErr)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisLock(t *testing.T) {
+	store, server := newMiniRedisStore(t)
+	ctx := context.Background()
+
+	lock := NewRedisLock(store, "resource", time.Second)
+	assert.NoError(t, lock.Acquire(ctx, 0))
+	other := NewRedisLock(store, "resource", time.Second)
+	acquired, err := other.TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	assert.True(t, serror.Is(other.Acquire(ctx, 100*time.Millisecond), serror.LOCK_NOT_ACQUIRED))
+	assert.True(t, serror.Is(other.Release(ctx), serror.LOCK_NOT_HELD))
+
+	assert.NoError(t, lock.Extend(ctx, time.Minute))
+	assert.True(t, server.TTL(lock.Key()) > time.Second)
+	assert.NoError(t, lock.Release(ctx))
+	assert.True(t, serror.Is(lock.Release(ctx), serror.LOCK_NOT_HELD))
+
+	// the lock expired and was taken by someone else, the first holder cannot touch it
+	assert.NoError(t, lock.Acquire(ctx, 0))
+	server.FastForward(2 * time.Second)
+	assert.NoError(t, other.Acquire(ctx, 0))
+	assert.True(t, serror.Is(lock.Extend(ctx, time.Second), serror.LOCK_NOT_HELD))
+	assert.Equal(t, other.Token(), must(server.Get(lock.Key())))
+}
+
+func must(value string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func TestRedisLockContext(t *testing.T) {
+	store, _ := newMiniRedisStore(t)
+	held := NewRedisLock(store, "resource", time.Second)
+	assert.NoError(t, held.Acquire(context.Background(), 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err := NewRedisLock(store, "resource", time.Second).Acquire(ctx, 0)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	err = WithRedisLock(ctx, store, "other", time.Second, 0, func(ctx context.Context) error { return nil })
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestRedisLockTTL(t *testing.T) {
+	store, _ := newMiniRedisStore(t)
+	ctx := context.Background()
+
+	_, err := NewRedisLock(store, "resource", 0).TryAcquire(ctx)
+	assert.True(t, serror.Is(err, serror.INVALID_DATA))
+	err = WithRedisLock(ctx, store, "resource", time.Nanosecond, 0, func(ctx context.Context) error { return nil })
+	assert.True(t, serror.Is(err, serror.INVALID_DATA))
+
+	// extending by nothing would delete the key and leave the lock up for grabs
+	lock := NewRedisLock(store, "resource", time.Second)
+	assert.NoError(t, lock.Acquire(ctx, 0))
+	assert.True(t, serror.Is(lock.Extend(ctx, 0), serror.INVALID_DATA))
+	acquired, err := NewRedisLock(store, "resource", time.Second).TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	assert.NoError(t, lock.Release(ctx))
+}
+
+func TestWithRedisLock(t *testing.T) {
+	// miniredis only expires keys when told to, the memory store does in real time
+	store := NewMemoryRedisStore()
+	ctx := context.Background()
+	exists := func() bool {
+		count, err := store.Exists("lock:resource")
+		assert.NoError(t, err)
+		return count == 1
+	}
+
+	// fn runs longer than the ttl, the lock is extended meanwhile
+	err := WithRedisLock(ctx, store, "resource", 100*time.Millisecond, 0, func(ctx context.Context) error {
+		time.Sleep(250 * time.Millisecond)
+		assert.True(t, exists())
+		assert.NoError(t, ctx.Err())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, exists())
+
+	failure := errors.New("failure")
+	err = WithRedisLock(ctx, store, "resource", time.Second, 0, func(ctx context.Context) error { return failure })
+	assert.Equal(t, failure, err)
+	assert.False(t, exists())
+}
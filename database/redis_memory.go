@@ -0,0 +1,1140 @@
+package database
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+var errNotInteger = errors.New("ERR value is not an integer or out of range")
+
+// how often expired keys nobody reads are dropped
+const memorySweepInterval = time.Second
+
+type memoryEntry struct {
+	// string, map[string]string (hash), map[string]struct{} (set),
+	// map[string]float64 (sorted set), []string (list) or *memoryStream
+	value    interface{}
+	expireAt time.Time
+}
+
+// MemoryRedisClient is a RedisRepresentable that keeps everything in process memory,
+// for unit tests and local development without a redis server.
+// Keys expire and empty hashes, sets and lists disappear like they do in redis.
+//
+// Lua scripts run like in redis, atomically, with the base, table, string and math
+// libraries and redis.call, pcall, error_reply and status_reply.
+//
+// It is not a redis server, its limits are:
+//   - scripts and Do only run the commands listed in memoryCommands, without cjson
+//     or the other libraries redis loads
+//   - XReadGroup only reads new entries, with ">"
+//   - contexts are ignored, commands are never cancelled, except a blocking XReadGroup
+//     and subscriptions which end with their context
+//
+// Use a real redis, e.g. miniredis in tests, for anything else.
+type MemoryRedisClient struct {
+	mu          sync.Mutex
+	data        map[string]*memoryEntry
+	lastSweep   time.Time
+	subscribers map[string]map[chan *redis.Message]struct{}
+	// scripts are compiled by sha1
+	scripts map[string]*lua.FunctionProto
+}
+
+func NewMemoryRedisClient() *MemoryRedisClient {
+	return &MemoryRedisClient{
+		data:        map[string]*memoryEntry{},
+		subscribers: map[string]map[chan *redis.Message]struct{}{},
+		scripts:     map[string]*lua.FunctionProto{},
+	}
+}
+
+// NewMemoryRedisStore returns a RedisStore backed by a MemoryRedisClient
+func NewMemoryRedisStore() RedisStore {
+	return NewRedisStoreFromClient(NewMemoryRedisClient())
+}
+
+// entry returns the live entry at key, dropping it if it expired. mu must be held.
+func (m *MemoryRedisClient) entry(key string) *memoryEntry {
+	e, ok := m.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !time.Now().Before(e.expireAt) {
+		delete(m.data, key)
+		return nil
+	}
+	return e
+}
+
+// put stores value at key, keeping the current expiration. mu must be held.
+func (m *MemoryRedisClient) put(key string, value interface{}) {
+	m.sweep()
+	if e := m.entry(key); e != nil {
+		e.value = value
+		return
+	}
+	m.data[key] = &memoryEntry{value: value}
+}
+
+// sweep drops expired keys at most once per memorySweepInterval. mu must be held.
+func (m *MemoryRedisClient) sweep() {
+	if time.Since(m.lastSweep) < memorySweepInterval {
+		return
+	}
+	m.lastSweep = time.Now()
+	for key := range m.data {
+		m.entry(key)
+	}
+}
+
+// dropIfEmpty deletes aggregates left without elements. mu must be held.
+func (m *MemoryRedisClient) dropIfEmpty(key string) {
+	e := m.entry(key)
+	if e == nil {
+		return
+	}
+	empty := false
+	switch v := e.value.(type) {
+	case map[string]string:
+		empty = len(v) == 0
+	case map[string]struct{}:
+		empty = len(v) == 0
+	case map[string]float64:
+		empty = len(v) == 0
+	case []string:
+		empty = len(v) == 0
+	}
+	if empty {
+		delete(m.data, key)
+	}
+}
+
+func (m *MemoryRedisClient) getString(key string) (string, bool, error) {
+	e := m.entry(key)
+	if e == nil {
+		return "", false, nil
+	}
+	v, ok := e.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return v, true, nil
+}
+
+func (m *MemoryRedisClient) getHash(key string, create bool) (map[string]string, error) {
+	e := m.entry(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		hash := map[string]string{}
+		m.put(key, hash)
+		return hash, nil
+	}
+	v, ok := e.value.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+func (m *MemoryRedisClient) getSet(key string, create bool) (map[string]struct{}, error) {
+	e := m.entry(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		set := map[string]struct{}{}
+		m.put(key, set)
+		return set, nil
+	}
+	v, ok := e.value.(map[string]struct{})
+	if !ok {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+func (m *MemoryRedisClient) getZSet(key string, create bool) (map[string]float64, error) {
+	e := m.entry(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		zset := map[string]float64{}
+		m.put(key, zset)
+		return zset, nil
+	}
+	v, ok := e.value.(map[string]float64)
+	if !ok {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+func (m *MemoryRedisClient) getList(key string) ([]string, error) {
+	e := m.entry(key)
+	if e == nil {
+		return nil, nil
+	}
+	v, ok := e.value.([]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+// memoryArg formats a command argument the way go-redis writes it on the wire
+func memoryArg(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", v)
+	}
+}
+
+// memoryArgs flattens variadic arguments like go-redis does for HSET, MSET, SADD...
+func memoryArgs(values []interface{}) ([]string, error) {
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case []string:
+			return v, nil
+		case []interface{}:
+			values = v
+		case map[string]interface{}:
+			values = make([]interface{}, 0, len(v)*2)
+			for key, value := range v {
+				values = append(values, key, value)
+			}
+		}
+	}
+
+	args := make([]string, 0, len(values))
+	for _, value := range values {
+		arg, err := memoryArg(value)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (m *MemoryRedisClient) Ping(ctx context.Context) *redis.StatusCmd {
+	return redis.NewStatusResult("PONG", nil)
+}
+
+func (m *MemoryRedisClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok, err := m.getString(key)
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (m *MemoryRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, key := range keys {
+		if m.entry(key) != nil {
+			delete(m.data, key)
+			deleted++
+		}
+	}
+	return redis.NewIntResult(deleted, nil)
+}
+
+func (m *MemoryRedisClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.set(key, value, expiration); err != nil {
+		return redis.NewStatusResult("", err)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+// set overwrites key and its expiration. mu must be held.
+func (m *MemoryRedisClient) set(key string, value interface{}, expiration time.Duration) error {
+	arg, err := memoryArg(value)
+	if err != nil {
+		return err
+	}
+	m.sweep()
+	e := &memoryEntry{value: arg}
+	if expiration > 0 {
+		e.expireAt = time.Now().Add(expiration)
+	}
+	m.data[key] = e
+	return nil
+}
+
+func (m *MemoryRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.entry(key) != nil {
+		return redis.NewBoolResult(false, nil)
+	}
+	if err := m.set(key, value, expiration); err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m *MemoryRedisClient) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		// like redis, keys of another type read as missing
+		if value, ok, err := m.getString(key); err == nil && ok {
+			values[i] = value
+		}
+	}
+	return redis.NewSliceResult(values, nil)
+}
+
+func (m *MemoryRedisClient) MSet(ctx context.Context, values ...interface{}) *redis.StatusCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, err := memoryArgs(values)
+	if err != nil {
+		return redis.NewStatusResult("", err)
+	}
+	if len(args)%2 != 0 {
+		return redis.NewStatusResult("", errors.New("ERR wrong number of arguments for 'mset' command"))
+	}
+	for i := 0; i < len(args); i += 2 {
+		m.set(args[i], args[i+1], 0)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (m *MemoryRedisClient) incrBy(key string, increment int64) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok, err := m.getString(key)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var current int64
+	if ok {
+		current, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewIntResult(0, errNotInteger)
+		}
+	}
+	current += increment
+	m.put(key, strconv.FormatInt(current, 10))
+	return redis.NewIntResult(current, nil)
+}
+
+func (m *MemoryRedisClient) Incr(ctx context.Context, key string) *redis.IntCmd {
+	return m.incrBy(key, 1)
+}
+
+func (m *MemoryRedisClient) IncrBy(ctx context.Context, key string, value int64) *redis.IntCmd {
+	return m.incrBy(key, value)
+}
+
+func (m *MemoryRedisClient) Decr(ctx context.Context, key string) *redis.IntCmd {
+	return m.incrBy(key, -1)
+}
+
+func (m *MemoryRedisClient) DecrBy(ctx context.Context, key string, decrement int64) *redis.IntCmd {
+	return m.incrBy(key, -decrement)
+}
+
+func (m *MemoryRedisClient) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return redis.NewBoolResult(m.expire(key, expiration), nil)
+}
+
+// expire sets the expiration of key, a non positive one deletes it. mu must be held.
+func (m *MemoryRedisClient) expire(key string, expiration time.Duration) bool {
+	e := m.entry(key)
+	if e == nil {
+		return false
+	}
+	if expiration <= 0 {
+		delete(m.data, key)
+		return true
+	}
+	e.expireAt = time.Now().Add(expiration)
+	return true
+}
+
+func (m *MemoryRedisClient) TTL(ctx context.Context, key string) *redis.DurationCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(key)
+	if e == nil {
+		return redis.NewDurationResult(-2, nil)
+	}
+	if e.expireAt.IsZero() {
+		return redis.NewDurationResult(-1, nil)
+	}
+	return redis.NewDurationResult(time.Until(e.expireAt).Round(time.Second), nil)
+}
+
+func (m *MemoryRedisClient) Persist(ctx context.Context, key string) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(key)
+	if e == nil || e.expireAt.IsZero() {
+		return redis.NewBoolResult(false, nil)
+	}
+	e.expireAt = time.Time{}
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m *MemoryRedisClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, key := range keys {
+		if m.entry(key) != nil {
+			count++
+		}
+	}
+	return redis.NewIntResult(count, nil)
+}
+
+func (m *MemoryRedisClient) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, err := memoryArgs(values)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return redis.NewIntResult(0, errors.New("ERR wrong number of arguments for 'hset' command"))
+	}
+	hash, err := m.getHash(key, true)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+
+	var added int64
+	for i := 0; i < len(args); i += 2 {
+		if _, ok := hash[args[i]]; !ok {
+			added++
+		}
+		hash[args[i]] = args[i+1]
+	}
+	return redis.NewIntResult(added, nil)
+}
+
+func (m *MemoryRedisClient) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, false)
+	if err != nil {
+		return redis.NewStringStringMapResult(nil, err)
+	}
+	result := make(map[string]string, len(hash))
+	for field, value := range hash {
+		result[field] = value
+	}
+	return redis.NewStringStringMapResult(result, nil)
+}
+
+func (m *MemoryRedisClient) HLen(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(hash)), nil)
+}
+
+func (m *MemoryRedisClient) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, false)
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	value, ok := hash[field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (m *MemoryRedisClient) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, false)
+	if err != nil {
+		return redis.NewSliceResult(nil, err)
+	}
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if value, ok := hash[field]; ok {
+			values[i] = value
+		}
+	}
+	return redis.NewSliceResult(values, nil)
+}
+
+func (m *MemoryRedisClient) HExists(ctx context.Context, key, field string) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, false)
+	if err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	_, ok := hash[field]
+	return redis.NewBoolResult(ok, nil)
+}
+
+func (m *MemoryRedisClient) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var deleted int64
+	for _, field := range fields {
+		if _, ok := hash[field]; ok {
+			delete(hash, field)
+			deleted++
+		}
+	}
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(deleted, nil)
+}
+
+func (m *MemoryRedisClient) HIncrBy(ctx context.Context, key, field string, increment int64) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash, err := m.getHash(key, true)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var current int64
+	if value, ok := hash[field]; ok {
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return redis.NewIntResult(0, errors.New("ERR hash value is not an integer"))
+		}
+	}
+	current += increment
+	hash[field] = strconv.FormatInt(current, 10)
+	return redis.NewIntResult(current, nil)
+}
+
+func (m *MemoryRedisClient) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, err := memoryArgs(members)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	set, err := m.getSet(key, true)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var added int64
+	for _, member := range args {
+		if _, ok := set[member]; !ok {
+			set[member] = struct{}{}
+			added++
+		}
+	}
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(added, nil)
+}
+
+func (m *MemoryRedisClient) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, err := memoryArgs(members)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	set, err := m.getSet(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var removed int64
+	for _, member := range args {
+		if _, ok := set[member]; ok {
+			delete(set, member)
+			removed++
+		}
+	}
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(removed, nil)
+}
+
+func (m *MemoryRedisClient) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set, err := m.getSet(key, false)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	return redis.NewStringSliceResult(members, nil)
+}
+
+func (m *MemoryRedisClient) SIsMember(ctx context.Context, key string, member interface{}) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	arg, err := memoryArg(member)
+	if err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	set, err := m.getSet(key, false)
+	if err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	_, ok := set[arg]
+	return redis.NewBoolResult(ok, nil)
+}
+
+func (m *MemoryRedisClient) SCard(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set, err := m.getSet(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(set)), nil)
+}
+
+func (m *MemoryRedisClient) ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset, err := m.getZSet(key, true)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var added int64
+	for _, z := range members {
+		member, err := memoryArg(z.Member)
+		if err != nil {
+			m.dropIfEmpty(key)
+			return redis.NewIntResult(0, err)
+		}
+		if _, ok := zset[member]; !ok {
+			added++
+		}
+		zset[member] = z.Score
+	}
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(added, nil)
+}
+
+func (m *MemoryRedisClient) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, err := memoryArgs(members)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	zset, err := m.getZSet(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var removed int64
+	for _, member := range args {
+		if _, ok := zset[member]; ok {
+			delete(zset, member)
+			removed++
+		}
+	}
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(removed, nil)
+}
+
+func (m *MemoryRedisClient) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset, err := m.getZSet(key, false)
+	if err != nil {
+		return redis.NewFloatResult(0, err)
+	}
+	score, ok := zset[member]
+	if !ok {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	return redis.NewFloatResult(score, nil)
+}
+
+func (m *MemoryRedisClient) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset, err := m.getZSet(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(zset)), nil)
+}
+
+// sortedMembers orders a sorted set by score, then member
+func sortedMembers(zset map[string]float64) []string {
+	members := make([]string, 0, len(zset))
+	for member := range zset {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if zset[members[i]] != zset[members[j]] {
+			return zset[members[i]] < zset[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// memoryRange resolves redis start/stop indexes, negative ones counting from the end
+func memoryRange(length int, start, stop int64) (int, int) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+func (m *MemoryRedisClient) ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset, err := m.getZSet(key, false)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	members := sortedMembers(zset)
+	from, to := memoryRange(len(members), start, stop)
+	return redis.NewStringSliceResult(members[from:to], nil)
+}
+
+// scoreBound parses a ZRANGEBYSCORE bound such as "-inf", "(1.5" or "3"
+func scoreBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch bound {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return score, exclusive, nil
+}
+
+// membersByScore returns the members of zset between min and max, ordered by score
+func membersByScore(zset map[string]float64, min, max string) ([]string, error) {
+	minScore, minExclusive, err := scoreBound(min)
+	if err != nil {
+		return nil, err
+	}
+	maxScore, maxExclusive, err := scoreBound(max)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []string{}
+	for _, member := range sortedMembers(zset) {
+		score := zset[member]
+		if score < minScore || (minExclusive && score == minScore) {
+			continue
+		}
+		if score > maxScore || (maxExclusive && score == maxScore) {
+			continue
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (m *MemoryRedisClient) ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset, err := m.getZSet(key, false)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	members, err := membersByScore(zset, opt.Min, opt.Max)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+
+	if opt.Offset > 0 {
+		if opt.Offset >= int64(len(members)) {
+			members = []string{}
+		} else {
+			members = members[opt.Offset:]
+		}
+	}
+	if opt.Count > 0 && opt.Count < int64(len(members)) {
+		members = members[:opt.Count]
+	}
+	return redis.NewStringSliceResult(members, nil)
+}
+
+func (m *MemoryRedisClient) ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset, err := m.getZSet(key, false)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	members, err := membersByScore(zset, min, max)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	for _, member := range members {
+		delete(zset, member)
+	}
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+func (m *MemoryRedisClient) push(key string, values []interface{}, left bool) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, err := memoryArgs(values)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	list, err := m.getList(key)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	for _, value := range args {
+		if left {
+			list = append([]string{value}, list...)
+		} else {
+			list = append(list, value)
+		}
+	}
+	m.put(key, list)
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(int64(len(list)), nil)
+}
+
+func (m *MemoryRedisClient) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return m.push(key, values, true)
+}
+
+func (m *MemoryRedisClient) RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return m.push(key, values, false)
+}
+
+// pop removes the first or last element of the list. mu must be held.
+func (m *MemoryRedisClient) pop(key string, left bool) (string, error) {
+	list, err := m.getList(key)
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", redis.Nil
+	}
+
+	var value string
+	if left {
+		value, list = list[0], list[1:]
+	} else {
+		value, list = list[len(list)-1], list[:len(list)-1]
+	}
+	m.put(key, list)
+	m.dropIfEmpty(key)
+	return value, nil
+}
+
+func (m *MemoryRedisClient) LPop(ctx context.Context, key string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return redis.NewStringResult(m.pop(key, true))
+}
+
+func (m *MemoryRedisClient) RPop(ctx context.Context, key string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return redis.NewStringResult(m.pop(key, false))
+}
+
+func (m *MemoryRedisClient) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.getList(key)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	from, to := memoryRange(len(list), start, stop)
+	values := make([]string, to-from)
+	copy(values, list[from:to])
+	return redis.NewStringSliceResult(values, nil)
+}
+
+func (m *MemoryRedisClient) LLen(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.getList(key)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(list)), nil)
+}
+
+func (m *MemoryRedisClient) LRem(ctx context.Context, key string, count int64, value interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	arg, err := memoryArg(value)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	list, err := m.getList(key)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+
+	// a negative count removes from the tail, walk the list backwards
+	reverse := count < 0
+	if reverse {
+		count = -count
+	}
+	kept := make([]string, 0, len(list))
+	var removed int64
+	for i := range list {
+		index := i
+		if reverse {
+			index = len(list) - 1 - i
+		}
+		if list[index] == arg && (count == 0 || removed < count) {
+			removed++
+			continue
+		}
+		kept = append(kept, list[index])
+	}
+	if reverse {
+		for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+			kept[i], kept[j] = kept[j], kept[i]
+		}
+	}
+
+	m.put(key, kept)
+	m.dropIfEmpty(key)
+	return redis.NewIntResult(removed, nil)
+}
+
+func (m *MemoryRedisClient) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payload, err := memoryArg(message)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+
+	var received int64
+	for subscriber := range m.subscribers[channel] {
+		// like redis, slow subscribers miss messages rather than blocking publishers
+		select {
+		case subscriber <- &redis.Message{Channel: channel, Payload: payload}:
+			received++
+		default:
+		}
+	}
+	return redis.NewIntResult(received, nil)
+}
+
+// subscribe is used by redisStore.Subscribe in place of redis.PubSub
+func (m *MemoryRedisClient) subscribe(ctx context.Context, channels ...string) *Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	incoming := make(chan *redis.Message, 100)
+	for _, channel := range channels {
+		if m.subscribers[channel] == nil {
+			m.subscribers[channel] = map[chan *redis.Message]struct{}{}
+		}
+		m.subscribers[channel][incoming] = struct{}{}
+	}
+
+	return newSubscription(ctx, incoming, func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, channel := range channels {
+			delete(m.subscribers[channel], incoming)
+		}
+		return nil
+	})
+}
+
+func (m *MemoryRedisClient) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	m.mu.Lock()
+	proto, ok := m.scripts[sha1]
+	m.mu.Unlock()
+	if !ok {
+		return redis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script. Please use EVAL."))
+	}
+	return redis.NewCmdResult(memoryCmdResult(m.evalScript(ctx, proto, keys, args)))
+}
+
+func (m *MemoryRedisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	hash, err := m.loadScript(script)
+	if err != nil {
+		return redis.NewCmdResult(nil, err)
+	}
+	return m.EvalSha(ctx, hash, keys, args...)
+}
+
+func (m *MemoryRedisClient) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exists := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		_, exists[i] = m.scripts[hash]
+	}
+	return redis.NewBoolSliceResult(exists, nil)
+}
+
+func (m *MemoryRedisClient) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return redis.NewStringResult(m.loadScript(script))
+}
+
+// Do runs the commands listed in memoryCommands
+func (m *MemoryRedisClient) Do(ctx context.Context, args ...interface{}) *redis.Cmd {
+	values, err := memoryArgs(args)
+	if err != nil {
+		return redis.NewCmdResult(nil, err)
+	}
+	return redis.NewCmdResult(memoryCmdResult(m.command(ctx, values)))
+}
+
+// memoryCmdResult shapes a reply like go-redis reads it, a nil reply is redis.Nil
+func memoryCmdResult(reply interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch reply := reply.(type) {
+	case nil:
+		return nil, redis.Nil
+	case memoryStatus:
+		return string(reply), nil
+	}
+	return reply, nil
+}
+
+var _ RedisRepresentable = (*MemoryRedisClient)(nil)
@@ -0,0 +1,633 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+var errSyntax = errors.New("ERR syntax error")
+
+// memoryStatus is a status reply such as OK, which scripts see as {ok = "OK"}
+type memoryStatus string
+
+type memoryCommand struct {
+	// arity counts the command name like redis does, a negative one is a minimum
+	arity int
+	// run gets the command name and its arguments, it runs with the data locked
+	run func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error)
+}
+
+// memoryCommands are the commands scripts and Do can run, replying like redis:
+// int64, string, nil, memoryStatus or []interface{} of those
+var memoryCommands = map[string]memoryCommand{
+	"ping": {-1, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryStatus("PONG"), nil
+	}},
+	"time": {1, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		now := time.Now()
+		return []interface{}{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}, nil
+	}},
+	"get": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.Get(ctx, args[1]).Result())
+	}},
+	"set": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		var expiration time.Duration
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch option := strings.ToLower(args[i]); option {
+			case "nx":
+				nx = true
+			case "ex", "px":
+				if i+1 >= len(args) {
+					return nil, errSyntax
+				}
+				i++
+				n, err := memoryInt(args[i])
+				if err != nil {
+					return nil, err
+				}
+				if n <= 0 {
+					return nil, errors.New("ERR invalid expire time in 'set' command")
+				}
+				expiration = time.Duration(n) * time.Millisecond
+				if option == "ex" {
+					expiration = time.Duration(n) * time.Second
+				}
+			default:
+				return nil, errSyntax
+			}
+		}
+		if !nx {
+			return memoryOK(m.Set(ctx, args[1], args[2], expiration).Result())
+		}
+		set, err := m.SetNX(ctx, args[1], args[2], expiration).Result()
+		if err != nil || !set {
+			return nil, err
+		}
+		return memoryStatus("OK"), nil
+	}},
+	"setnx": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryBool(m.SetNX(ctx, args[1], args[2], 0).Result())
+	}},
+	"del": {-2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.Del(ctx, args[1:]...).Result())
+	}},
+	"exists": {-2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.Exists(ctx, args[1:]...).Result())
+	}},
+	"expire": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		seconds, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return memoryBool(m.Expire(ctx, args[1], time.Duration(seconds)*time.Second).Result())
+	}},
+	"pexpire": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		milliseconds, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return memoryBool(m.Expire(ctx, args[1], time.Duration(milliseconds)*time.Millisecond).Result())
+	}},
+	"ttl": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return m.ttl(args[1], time.Second), nil
+	}},
+	"pttl": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return m.ttl(args[1], time.Millisecond), nil
+	}},
+	"persist": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryBool(m.Persist(ctx, args[1]).Result())
+	}},
+	"incr": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.Incr(ctx, args[1]).Result())
+	}},
+	"decr": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.Decr(ctx, args[1]).Result())
+	}},
+	"incrby": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		increment, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return memoryReply(m.IncrBy(ctx, args[1], increment).Result())
+	}},
+	"decrby": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		decrement, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return memoryReply(m.DecrBy(ctx, args[1], decrement).Result())
+	}},
+	"mget": {-2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.MGet(ctx, args[1:]...).Result())
+	}},
+	"mset": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryOK(m.MSet(ctx, memoryValues(args[1:])...).Result())
+	}},
+	"hset": {-4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.HSet(ctx, args[1], memoryValues(args[2:])...).Result())
+	}},
+	"hget": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.HGet(ctx, args[1], args[2]).Result())
+	}},
+	"hgetall": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		hash, err := m.HGetAll(ctx, args[1]).Result()
+		if err != nil {
+			return nil, err
+		}
+		fields := make([]string, 0, len(hash))
+		for field := range hash {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		reply := make([]interface{}, 0, len(hash)*2)
+		for _, field := range fields {
+			reply = append(reply, field, hash[field])
+		}
+		return reply, nil
+	}},
+	"hmget": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.HMGet(ctx, args[1], args[2:]...).Result())
+	}},
+	"hdel": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.HDel(ctx, args[1], args[2:]...).Result())
+	}},
+	"hlen": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.HLen(ctx, args[1]).Result())
+	}},
+	"hexists": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryBool(m.HExists(ctx, args[1], args[2]).Result())
+	}},
+	"hincrby": {4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		increment, err := memoryInt(args[3])
+		if err != nil {
+			return nil, err
+		}
+		return memoryReply(m.HIncrBy(ctx, args[1], args[2], increment).Result())
+	}},
+	"sadd": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.SAdd(ctx, args[1], memoryValues(args[2:])...).Result())
+	}},
+	"srem": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.SRem(ctx, args[1], memoryValues(args[2:])...).Result())
+	}},
+	"smembers": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		members, err := m.SMembers(ctx, args[1]).Result()
+		sort.Strings(members)
+		return memoryList(members, err)
+	}},
+	"sismember": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryBool(m.SIsMember(ctx, args[1], args[2]).Result())
+	}},
+	"scard": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.SCard(ctx, args[1]).Result())
+	}},
+	"zadd": {-4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		if len(args)%2 != 0 {
+			return nil, errSyntax
+		}
+		members := make([]*redis.Z, 0, len(args)/2-1)
+		for i := 2; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return nil, errors.New("ERR value is not a valid float")
+			}
+			members = append(members, &redis.Z{Score: score, Member: args[i+1]})
+		}
+		return memoryReply(m.ZAdd(ctx, args[1], members...).Result())
+	}},
+	"zrem": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.ZRem(ctx, args[1], memoryValues(args[2:])...).Result())
+	}},
+	"zscore": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		score, err := m.ZScore(ctx, args[1], args[2]).Result()
+		if err != nil {
+			return memoryReply(nil, err)
+		}
+		return memoryFloat(score), nil
+	}},
+	"zcard": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.ZCard(ctx, args[1]).Result())
+	}},
+	"zrange": {-4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		start, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		stop, err := memoryInt(args[3])
+		if err != nil {
+			return nil, err
+		}
+		withScores := false
+		for _, option := range args[4:] {
+			if strings.ToLower(option) != "withscores" {
+				return nil, errSyntax
+			}
+			withScores = true
+		}
+		members, err := m.ZRange(ctx, args[1], start, stop).Result()
+		return m.withScores(ctx, args[1], members, withScores, err)
+	}},
+	"zrangebyscore": {-4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		opt := &redis.ZRangeBy{Min: args[2], Max: args[3]}
+		withScores := false
+		for i := 4; i < len(args); i++ {
+			switch strings.ToLower(args[i]) {
+			case "withscores":
+				withScores = true
+			case "limit":
+				if i+2 >= len(args) {
+					return nil, errSyntax
+				}
+				offset, err := memoryInt(args[i+1])
+				if err != nil {
+					return nil, err
+				}
+				count, err := memoryInt(args[i+2])
+				if err != nil {
+					return nil, err
+				}
+				opt.Offset, opt.Count = offset, count
+				i += 2
+			default:
+				return nil, errSyntax
+			}
+		}
+		members, err := m.ZRangeByScore(ctx, args[1], opt).Result()
+		return m.withScores(ctx, args[1], members, withScores, err)
+	}},
+	"zremrangebyscore": {4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.ZRemRangeByScore(ctx, args[1], args[2], args[3]).Result())
+	}},
+	"lpush": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.LPush(ctx, args[1], memoryValues(args[2:])...).Result())
+	}},
+	"rpush": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.RPush(ctx, args[1], memoryValues(args[2:])...).Result())
+	}},
+	"lpop": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.LPop(ctx, args[1]).Result())
+	}},
+	"rpop": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.RPop(ctx, args[1]).Result())
+	}},
+	"lrange": {4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		start, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		stop, err := memoryInt(args[3])
+		if err != nil {
+			return nil, err
+		}
+		return memoryList(m.LRange(ctx, args[1], start, stop).Result())
+	}},
+	"llen": {2, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.LLen(ctx, args[1]).Result())
+	}},
+	"lrem": {4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		count, err := memoryInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return memoryReply(m.LRem(ctx, args[1], count, args[3]).Result())
+	}},
+	"publish": {3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.Publish(ctx, args[1], args[2]).Result())
+	}},
+	"xack": {-4, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return memoryReply(m.XAck(ctx, args[1], args[2], args[3:]...).Result())
+	}},
+	"xautoclaim": {-6, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return m.xautoclaim(args[1:])
+	}},
+	"xpending": {-3, func(m *MemoryRedisClient, ctx context.Context, args []string) (interface{}, error) {
+		return m.xpending(args[1:])
+	}},
+}
+
+func memoryInt(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
+// memoryFloat formats a score like redis replies with it
+func memoryFloat(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e17 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', 17, 64)
+}
+
+func memoryValues(args []string) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
+
+// memoryReply turns a missing value into the nil reply
+func memoryReply(value interface{}, err error) (interface{}, error) {
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func memoryBool(value bool, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	if value {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func memoryOK(_ string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return memoryStatus("OK"), nil
+}
+
+func memoryList(values []string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	reply := make([]interface{}, len(values))
+	for i, value := range values {
+		reply[i] = value
+	}
+	return reply, nil
+}
+
+// withScores follows each member of the sorted set key with its score if asked to
+func (m *MemoryRedisClient) withScores(ctx context.Context, key string, members []string, withScores bool, err error) (interface{}, error) {
+	if err != nil || !withScores {
+		return memoryList(members, err)
+	}
+	reply := make([]interface{}, 0, len(members)*2)
+	for _, member := range members {
+		score, err := m.ZScore(ctx, key, member).Result()
+		if err != nil {
+			return nil, err
+		}
+		reply = append(reply, member, memoryFloat(score))
+	}
+	return reply, nil
+}
+
+// ttl replies like TTL and PTTL, in unit. mu must be held.
+func (m *MemoryRedisClient) ttl(key string, unit time.Duration) int64 {
+	e := m.entry(key)
+	if e == nil {
+		return -2
+	}
+	if e.expireAt.IsZero() {
+		return -1
+	}
+	return int64((time.Until(e.expireAt) + unit/2) / unit)
+}
+
+// locked runs fn with the data locked, on a client sharing it whose own lock is free,
+// so a script or a command made of several steps runs atomically
+func (m *MemoryRedisClient) locked(fn func(shared *MemoryRedisClient)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shared := &MemoryRedisClient{data: m.data, lastSweep: m.lastSweep, subscribers: m.subscribers}
+	fn(shared)
+	m.lastSweep = shared.lastSweep
+}
+
+// command runs args, the command name first. mu must not be held.
+func (m *MemoryRedisClient) command(ctx context.Context, args []string) (reply interface{}, err error) {
+	m.locked(func(shared *MemoryRedisClient) {
+		reply, err = shared.run(ctx, args)
+	})
+	return reply, err
+}
+
+// run runs args, the command name first, on a client whose data is locked
+func (m *MemoryRedisClient) run(ctx context.Context, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("ERR empty command")
+	}
+	name := strings.ToLower(args[0])
+	command, ok := memoryCommands[name]
+	if !ok {
+		return nil, fmt.Errorf("ERR unknown command '%s' for the in-memory redis client", args[0])
+	}
+	if (command.arity > 0 && len(args) != command.arity) || (command.arity < 0 && len(args) < -command.arity) {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+	return command.run(m, ctx, args)
+}
+
+// compileScript parses the lua script, redis runs it as the body of a function
+func compileScript(script string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), "@user_script")
+	if err != nil {
+		return nil, errors.Errorf("ERR Error compiling script: %v", err)
+	}
+	proto, err := lua.Compile(chunk, "@user_script")
+	if err != nil {
+		return nil, errors.Errorf("ERR Error compiling script: %v", err)
+	}
+	return proto, nil
+}
+
+// loadScript compiles the script unless it was already, returning its sha1
+func (m *MemoryRedisClient) loadScript(script string) (string, error) {
+	hash := redis.NewScript(script).Hash()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.scripts[hash]; ok {
+		return hash, nil
+	}
+	proto, err := compileScript(script)
+	if err != nil {
+		return "", err
+	}
+	m.scripts[hash] = proto
+	return hash, nil
+}
+
+// evalScript runs the script with the data locked for its whole run, like redis does
+func (m *MemoryRedisClient) evalScript(ctx context.Context, proto *lua.FunctionProto, keys []string, args []interface{}) (reply interface{}, err error) {
+	argv, err := memoryArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	m.locked(func(shared *MemoryRedisClient) {
+		L := lua.NewState(lua.Options{SkipOpenLibs: true})
+		defer L.Close()
+		for _, lib := range []struct {
+			name string
+			open lua.LGFunction
+		}{
+			{lua.BaseLibName, lua.OpenBase},
+			{lua.TabLibName, lua.OpenTable},
+			{lua.StringLibName, lua.OpenString},
+			{lua.MathLibName, lua.OpenMath},
+		} {
+			L.Push(L.NewFunction(lib.open))
+			L.Push(lua.LString(lib.name))
+			L.Call(1, 0)
+		}
+
+		L.SetGlobal("KEYS", luaStrings(L, keys))
+		L.SetGlobal("ARGV", luaStrings(L, argv))
+		L.SetGlobal("redis", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+			"call":  shared.luaCall(ctx, false),
+			"pcall": shared.luaCall(ctx, true),
+			"error_reply": func(L *lua.LState) int {
+				L.Push(luaReply(L, errors.New(L.CheckString(1))))
+				return 1
+			},
+			"status_reply": func(L *lua.LState) int {
+				L.Push(luaReply(L, memoryStatus(L.CheckString(1))))
+				return 1
+			},
+			// effects are always replicated from redis 5
+			"replicate_commands": func(L *lua.LState) int {
+				L.Push(lua.LTrue)
+				return 1
+			},
+		}))
+
+		L.Push(L.NewFunctionFromProto(proto))
+		if err = L.PCall(0, 1, nil); err != nil {
+			var apiErr *lua.ApiError
+			if errors.As(err, &apiErr) {
+				err = errors.New(apiErr.Object.String())
+			}
+			return
+		}
+		reply, err = scriptReply(L.Get(-1))
+	})
+	return reply, err
+}
+
+// luaCall is redis.call, or redis.pcall which returns errors as {err = "..."} instead of raising them
+func (m *MemoryRedisClient) luaCall(ctx context.Context, protected bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		args := make([]string, 0, L.GetTop())
+		for i := 1; i <= L.GetTop(); i++ {
+			switch arg := L.Get(i).(type) {
+			case lua.LString:
+				args = append(args, string(arg))
+			case lua.LNumber:
+				args = append(args, arg.String())
+			default:
+				L.Error(lua.LString("ERR Lua redis lib command arguments must be strings or integers"), 0)
+				return 0
+			}
+		}
+
+		reply, err := m.run(ctx, args)
+		if err != nil {
+			if !protected {
+				L.Error(lua.LString(err.Error()), 0)
+				return 0
+			}
+			reply = err
+		}
+		L.Push(luaReply(L, reply))
+		return 1
+	}
+}
+
+func luaStrings(L *lua.LState, values []string) *lua.LTable {
+	table := L.CreateTable(len(values), 0)
+	for _, value := range values {
+		table.Append(lua.LString(value))
+	}
+	return table
+}
+
+// luaReply converts a command reply the way redis hands it to scripts
+func luaReply(L *lua.LState, reply interface{}) lua.LValue {
+	switch reply := reply.(type) {
+	case nil:
+		return lua.LFalse
+	case int64:
+		return lua.LNumber(reply)
+	case string:
+		return lua.LString(reply)
+	case memoryStatus:
+		table := L.NewTable()
+		table.RawSetString("ok", lua.LString(reply))
+		return table
+	case error:
+		table := L.NewTable()
+		table.RawSetString("err", lua.LString(reply.Error()))
+		return table
+	case []interface{}:
+		table := L.CreateTable(len(reply), 0)
+		for _, value := range reply {
+			table.Append(luaReply(L, value))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(reply))
+	}
+}
+
+// scriptReply converts what a script returns the way redis replies with it:
+// numbers are truncated to integers, true is 1, false is nil and arrays stop at their first nil
+func scriptReply(value lua.LValue) (interface{}, error) {
+	switch value := value.(type) {
+	case lua.LNumber:
+		return int64(value), nil
+	case lua.LString:
+		return string(value), nil
+	case lua.LBool:
+		if value {
+			return int64(1), nil
+		}
+		return nil, nil
+	case *lua.LTable:
+		if err, ok := value.RawGetString("err").(lua.LString); ok {
+			return nil, errors.New(string(err))
+		}
+		if status, ok := value.RawGetString("ok").(lua.LString); ok {
+			return string(status), nil
+		}
+		reply := []interface{}{}
+		for i := 1; ; i++ {
+			item := value.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			converted, err := scriptReply(item)
+			if err != nil {
+				converted = err
+			}
+			reply = append(reply, converted)
+		}
+		return reply, nil
+	default:
+		return nil, nil
+	}
+}
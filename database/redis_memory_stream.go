@@ -0,0 +1,390 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// how often a blocked XREADGROUP on the in-memory client looks for new entries
+const memoryBlockPoll = 10 * time.Millisecond
+
+type memoryStream struct {
+	entries []redis.XMessage
+	lastId  memoryStreamId
+	groups  map[string]*memoryStreamGroup
+}
+
+type memoryStreamGroup struct {
+	lastDelivered memoryStreamId
+	pending       map[string]*memoryPending
+}
+
+type memoryPending struct {
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int64
+}
+
+type memoryStreamId struct {
+	ms  int64
+	seq int64
+}
+
+func (id memoryStreamId) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id memoryStreamId) less(other memoryStreamId) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// parseStreamId reads "<ms>-<seq>" or "<ms>", "$" must be resolved by the caller
+func parseStreamId(id string) (memoryStreamId, error) {
+	invalid := errors.New("ERR Invalid stream ID specified as stream command argument")
+	parts := strings.SplitN(id, "-", 2)
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return memoryStreamId{}, invalid
+	}
+	var seq int64
+	if len(parts) == 2 {
+		if seq, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return memoryStreamId{}, invalid
+		}
+	}
+	return memoryStreamId{ms: ms, seq: seq}, nil
+}
+
+// getStream returns the stream at key, creating it if asked. mu must be held.
+func (m *MemoryRedisClient) getStream(key string, create bool) (*memoryStream, error) {
+	e := m.entry(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		stream := &memoryStream{groups: map[string]*memoryStreamGroup{}}
+		m.put(key, stream)
+		return stream, nil
+	}
+	stream, ok := e.value.(*memoryStream)
+	if !ok {
+		return nil, errWrongType
+	}
+	return stream, nil
+}
+
+func (s *memoryStream) find(id string) (redis.XMessage, bool) {
+	for _, entry := range s.entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return redis.XMessage{}, false
+}
+
+func (m *MemoryRedisClient) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var args []string
+	var err error
+	switch values := a.Values.(type) {
+	case map[string]interface{}:
+		args, err = memoryArgs([]interface{}{values})
+	case []interface{}:
+		args, err = memoryArgs(values)
+	case []string:
+		args = values
+	default:
+		err = fmt.Errorf("redis: unsupported stream values %T", a.Values)
+	}
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return redis.NewStringResult("", errors.New("ERR wrong number of arguments for 'xadd' command"))
+	}
+
+	stream, err := m.getStream(a.Stream, false)
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	var last memoryStreamId
+	if stream != nil {
+		last = stream.lastId
+	}
+
+	var id memoryStreamId
+	if a.ID == "" || a.ID == "*" {
+		id = memoryStreamId{ms: time.Now().UnixMilli()}
+		if !last.less(id) {
+			id = memoryStreamId{ms: last.ms, seq: last.seq + 1}
+		}
+	} else {
+		if id, err = parseStreamId(a.ID); err != nil {
+			return redis.NewStringResult("", err)
+		}
+		if !last.less(id) {
+			return redis.NewStringResult("", errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item"))
+		}
+	}
+
+	if stream == nil {
+		stream, _ = m.getStream(a.Stream, true)
+	}
+	values := make(map[string]interface{}, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		values[args[i]] = args[i+1]
+	}
+	stream.entries = append(stream.entries, redis.XMessage{ID: id.String(), Values: values})
+	stream.lastId = id
+
+	maxLen := a.MaxLen
+	if maxLen == 0 {
+		maxLen = a.MaxLenApprox
+	}
+	if maxLen > 0 && int64(len(stream.entries)) > maxLen {
+		stream.entries = stream.entries[int64(len(stream.entries))-maxLen:]
+	}
+	return redis.NewStringResult(id.String(), nil)
+}
+
+func (m *MemoryRedisClient) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.getStream(stream, true)
+	if err != nil {
+		return redis.NewStatusResult("", err)
+	}
+	if _, ok := s.groups[group]; ok {
+		return redis.NewStatusResult("", errors.New("BUSYGROUP Consumer Group name already exists"))
+	}
+
+	lastDelivered := s.lastId
+	if start != "$" {
+		if lastDelivered, err = parseStreamId(start); err != nil {
+			return redis.NewStatusResult("", err)
+		}
+	}
+	s.groups[group] = &memoryStreamGroup{lastDelivered: lastDelivered, pending: map[string]*memoryPending{}}
+	return redis.NewStatusResult("OK", nil)
+}
+
+// XReadGroup only reads new entries, with ">", which is all StreamWorker needs
+func (m *MemoryRedisClient) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	if len(a.Streams) != 2 || a.Streams[1] != ">" {
+		return redis.NewXStreamSliceCmdResult(nil, errors.New("ERR the in-memory redis client only reads one stream from >"))
+	}
+
+	var deadline time.Time
+	if a.Block > 0 {
+		deadline = time.Now().Add(a.Block)
+	}
+	for {
+		messages, err := m.readGroup(a)
+		if err != nil {
+			return redis.NewXStreamSliceCmdResult(nil, err)
+		}
+		if len(messages) > 0 {
+			return redis.NewXStreamSliceCmdResult([]redis.XStream{{Stream: a.Streams[0], Messages: messages}}, nil)
+		}
+		// a negative block does not wait, zero waits forever like redis
+		if a.Block < 0 || (!deadline.IsZero() && time.Now().After(deadline)) {
+			return redis.NewXStreamSliceCmdResult(nil, redis.Nil)
+		}
+		select {
+		case <-ctx.Done():
+			return redis.NewXStreamSliceCmdResult(nil, ctx.Err())
+		case <-time.After(memoryBlockPoll):
+		}
+	}
+}
+
+func (m *MemoryRedisClient) readGroup(a *redis.XReadGroupArgs) ([]redis.XMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, err := m.getStream(a.Streams[0], false)
+	if err != nil {
+		return nil, err
+	}
+	var group *memoryStreamGroup
+	if stream != nil {
+		group = stream.groups[a.Group]
+	}
+	if group == nil {
+		return nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", a.Streams[0], a.Group)
+	}
+
+	messages := []redis.XMessage{}
+	for _, entry := range stream.entries {
+		if a.Count > 0 && int64(len(messages)) >= a.Count {
+			break
+		}
+		id, _ := parseStreamId(entry.ID)
+		if !group.lastDelivered.less(id) {
+			continue
+		}
+		group.lastDelivered = id
+		if !a.NoAck {
+			group.pending[entry.ID] = &memoryPending{consumer: a.Consumer, deliveredAt: time.Now(), deliveries: 1}
+		}
+		messages = append(messages, entry)
+	}
+	return messages, nil
+}
+
+func (m *MemoryRedisClient) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.getStream(stream, false)
+	if err != nil || s == nil || s.groups[group] == nil {
+		return redis.NewIntResult(0, err)
+	}
+	var acked int64
+	for _, id := range ids {
+		if _, ok := s.groups[group].pending[id]; ok {
+			delete(s.groups[group].pending, id)
+			acked++
+		}
+	}
+	return redis.NewIntResult(acked, nil)
+}
+
+// xpending takes stream, group, start, end, count [consumer] and replies like redis,
+// "-" and "+" are the open bounds. mu must be held.
+func (m *MemoryRedisClient) xpending(args []string) (interface{}, error) {
+	if len(args) != 5 && len(args) != 6 {
+		return nil, errors.New("ERR the in-memory redis client only supports the extended form of xpending")
+	}
+	bound := func(id string, open memoryStreamId) (memoryStreamId, error) {
+		if id == "-" || id == "+" {
+			return open, nil
+		}
+		return parseStreamId(id)
+	}
+	start, err := bound(args[2], memoryStreamId{})
+	if err != nil {
+		return nil, err
+	}
+	end, err := bound(args[3], memoryStreamId{ms: math.MaxInt64, seq: math.MaxInt64})
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	consumer := ""
+	if len(args) == 6 {
+		consumer = args[5]
+	}
+
+	stream, err := m.getStream(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if stream == nil || stream.groups[args[1]] == nil {
+		return nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", args[0], args[1])
+	}
+	group := stream.groups[args[1]]
+
+	ids := []memoryStreamId{}
+	for id, pending := range group.pending {
+		parsed, _ := parseStreamId(id)
+		if parsed.less(start) || end.less(parsed) || (consumer != "" && pending.consumer != consumer) {
+			continue
+		}
+		ids = append(ids, parsed)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	if int64(len(ids)) > count {
+		ids = ids[:count]
+	}
+
+	reply := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		pending := group.pending[id.String()]
+		reply = append(reply, []interface{}{id.String(), pending.consumer, time.Since(pending.deliveredAt).Milliseconds(), pending.deliveries})
+	}
+	return reply, nil
+}
+
+// xautoclaim takes stream, group, consumer, min idle ms, start [COUNT count]
+// and replies like redis 6.2. mu must be held.
+func (m *MemoryRedisClient) xautoclaim(args []string) (interface{}, error) {
+	if len(args) != 5 && len(args) != 7 {
+		return nil, errors.New("ERR wrong number of arguments for 'xautoclaim' command")
+	}
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	start, err := parseStreamId(args[4])
+	if err != nil {
+		return nil, err
+	}
+	count := int64(100)
+	if len(args) == 7 {
+		if count, err = strconv.ParseInt(args[6], 10, 64); err != nil {
+			return nil, errNotInteger
+		}
+	}
+
+	stream, err := m.getStream(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if stream == nil || stream.groups[args[1]] == nil {
+		return nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", args[0], args[1])
+	}
+	group := stream.groups[args[1]]
+
+	ids := []memoryStreamId{}
+	for id := range group.pending {
+		parsed, _ := parseStreamId(id)
+		if !parsed.less(start) {
+			ids = append(ids, parsed)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+
+	claimed := []interface{}{}
+	next := "0-0"
+	for i, id := range ids {
+		if int64(len(claimed)) >= count {
+			next = ids[i].String()
+			break
+		}
+		pending := group.pending[id.String()]
+		if time.Since(pending.deliveredAt) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+		pending.consumer = args[2]
+		pending.deliveredAt = time.Now()
+		pending.deliveries++
+
+		entry, ok := stream.find(id.String())
+		if !ok {
+			// trimmed from the stream, redis 6.2 claims it without values
+			claimed = append(claimed, []interface{}{id.String(), nil})
+			continue
+		}
+		values := make([]interface{}, 0, len(entry.Values)*2)
+		for field, value := range entry.Values {
+			values = append(values, field, value)
+		}
+		claimed = append(claimed, []interface{}{entry.ID, values})
+	}
+	return []interface{}{next, claimed}, nil
+}
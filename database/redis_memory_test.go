@@ -0,0 +1,394 @@
+package database
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRedisStoreExpiry(t *testing.T) {
+	store := NewMemoryRedisStore()
+
+	assert.NoError(t, store.Set("key", "value", 50*time.Millisecond))
+	value, err := store.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	ttl, err := store.TTL("key")
+	assert.NoError(t, err)
+	assert.True(t, ttl <= time.Second)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = store.Get("key")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	_, err = store.TTL("key")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	assert.True(t, serror.Is(store.Expire("key", time.Second), serror.NOT_FOUND))
+
+	assert.NoError(t, store.Set("forever", 1, 0))
+	ttl, err = store.TTL("forever")
+	assert.NoError(t, err)
+	assert.True(t, ttl < 0)
+}
+
+func TestMemoryRedisStoreHash(t *testing.T) {
+	store := NewMemoryRedisStore()
+
+	assert.NoError(t, store.HSet("hash", map[string]interface{}{"a": 1, "b": "two"}))
+	data, err := store.HGetAll("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "two"}, data)
+	length, err := store.HMLen("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), length)
+
+	deleted, err := store.HDel("hash", "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	// like redis, the key is gone with its last field
+	exists, err := store.Exists("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+
+	_, err = store.HGetAll("hash")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	_, err = store.HMLen("hash")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+	assert.NoError(t, store.Set("string", "value", 0))
+	_, err = store.HGetAll("string")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+}
+
+func TestMemoryRedisStoreCollections(t *testing.T) {
+	store := NewMemoryRedisStore()
+
+	_, err := store.LPop("list")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	store.RPush("list", "a", "b", "c")
+	values, err := store.LRange("list", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, values)
+	value, err := store.LPop("list")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), value)
+
+	store.ZAdd("zset", &redis.Z{Score: 2, Member: "b"}, &redis.Z{Score: 1, Member: "a"})
+	members, err := store.ZRangeByScore("zset", &redis.ZRangeBy{Min: "(1", Max: "+inf"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, members)
+	_, err = store.ZScore("zset", "missing")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+	count, err := store.Incr("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemoryRedisStoreScripts(t *testing.T) {
+	store := NewMemoryRedisStore()
+	ctx := context.Background()
+
+	lock := NewRedisLock(store, "resource", time.Second)
+	acquired, err := lock.TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = NewRedisLock(store, "resource", time.Second).TryAcquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	assert.NoError(t, lock.Release(ctx))
+
+	limiter := NewRateLimiter(store, 2, time.Minute)
+	for i := 0; i < 2; i++ {
+		result, err := limiter.Allow(ctx, "client")
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, err := limiter.Allow(ctx, "client")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func TestMemoryRedisStorePubSub(t *testing.T) {
+	store := NewMemoryRedisStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, err := store.Subscribe(ctx, "events")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Publish("events", "hello"))
+	message := <-subscription.Messages()
+	assert.Equal(t, RedisMessage{Channel: "events", Payload: "hello"}, message)
+	assert.NoError(t, subscription.Close())
+}
+
+func TestMemoryRedisStoreHashFields(t *testing.T) {
+	store := NewMemoryRedisStore()
+
+	_, err := store.HGet("hash", "a")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+	assert.NoError(t, store.HSet("hash", map[string]interface{}{"a": "1"}))
+	value, err := store.HGet("hash", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+	_, err = store.HGet("hash", "b")
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+	values, err := store.HMGet("hash", "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"a": []byte("1")}, values)
+
+	exists, err := store.HExists("hash", "b")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestMemoryRedisScripts(t *testing.T) {
+	redisStore, _ := newMiniRedisStore(t)
+	for name, store := range map[string]RedisStore{"redis": redisStore, "memory": NewMemoryRedisStore()} {
+		t.Run(name, func(t *testing.T) {
+			// scripts other than the ones of the package run too
+			script := redis.NewScript(`
+redis.call("hincrby", KEYS[1], "count", ARGV[1])
+local ok, missing = redis.call("set", KEYS[2], "v", "nx"), redis.call("get", KEYS[3])
+return {redis.call("hget", KEYS[1], "count"), ok["ok"], tostring(missing), redis.pcall("incr", KEYS[1])["err"]}
+`)
+			reply, err := store.Eval(script, []string{"hash", "key", "missing"}, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"2", "OK", "false", "WRONGTYPE Operation against a key holding the wrong kind of value"}, reply)
+
+			_, err = store.Eval(redis.NewScript(`return redis.call("get", KEYS[1], "extra")`), []string{"key"})
+			assert.ErrorContains(t, err, "wrong number of arguments")
+			_, err = store.Eval(redis.NewScript(`return redis.error_reply("ERR custom")`), nil)
+			assert.ErrorContains(t, err, "ERR custom")
+			_, err = store.Eval(redis.NewScript(`return false`), nil)
+			assert.True(t, serror.Is(err, serror.NOT_FOUND))
+		})
+	}
+}
+
+// scriptRun is one call of a script with its keys and arguments
+type scriptRun struct {
+	keys []string
+	args []interface{}
+}
+
+// every script of the package is run on redis and on the in-memory client, the replies
+// and the keys left behind must be the same
+func TestMemoryRedisScriptParity(t *testing.T) {
+	job := func(id string) string {
+		return `{"id":"` + id + `","type":"test","payload":{"n":1}}`
+	}
+	inflight := []string{"inflight", "deliveries"}
+	jobs := []string{"jobs", "attempts", "maxAttempts"}
+
+	cases := map[string]struct {
+		script *redis.Script
+		setup  func(store RedisStore)
+		runs   []scriptRun
+		// keys compared once the runs are done
+		state []string
+		// normalize replaces what depends on the clock
+		normalize func(reply interface{}) interface{}
+	}{
+		"releaseLockScript": {
+			script: releaseLockScript,
+			setup:  func(store RedisStore) { store.Set("lock", "token", 0) },
+			runs: []scriptRun{
+				{[]string{"lock"}, []interface{}{"other"}},
+				{[]string{"lock"}, []interface{}{"token"}},
+				{[]string{"lock"}, []interface{}{"token"}},
+			},
+			state: []string{"lock"},
+		},
+		"extendLockScript": {
+			script: extendLockScript,
+			setup:  func(store RedisStore) { store.Set("lock", "token", time.Minute) },
+			runs: []scriptRun{
+				{[]string{"lock"}, []interface{}{"other", 1000}},
+				{[]string{"lock"}, []interface{}{"token", 120000}},
+			},
+			state: []string{"lock"},
+		},
+		"rateLimitScript": {
+			script: rateLimitScript,
+			setup:  func(store RedisStore) {},
+			runs: []scriptRun{
+				{[]string{"rate"}, []interface{}{60000, 2, "a"}},
+				{[]string{"rate"}, []interface{}{60000, 2, "b"}},
+				{[]string{"rate"}, []interface{}{60000, 2, "c"}},
+			},
+			normalize: func(reply interface{}) interface{} {
+				values := reply.([]interface{})
+				reset := values[2].(int64)
+				return []interface{}{values[0], values[1], reset > 0 && reset <= 60000}
+			},
+		},
+		"promoteJobsScript": {
+			script: promoteJobsScript,
+			setup: func(store RedisStore) {
+				store.ZAdd("scheduled", &redis.Z{Score: 1000, Member: "a"}, &redis.Z{Score: 2000, Member: "b"}, &redis.Z{Score: 5000, Member: "c"})
+				store.RPush("ready", "x")
+			},
+			runs: []scriptRun{
+				{[]string{"scheduled", "ready"}, []interface{}{2000, 1}},
+				{[]string{"scheduled", "ready"}, []interface{}{2000, 100}},
+				{[]string{"scheduled", "ready"}, []interface{}{2000, 100}},
+			},
+			state: []string{"scheduled", "ready"},
+		},
+		"dequeueJobScript": {
+			script: dequeueJobScript,
+			setup: func(store RedisStore) {
+				store.RPush("ready", "job_1", "job_2")
+				store.HSet("jobs", map[string]interface{}{"job_1": job("job_1")})
+				store.HSet("attempts", map[string]interface{}{"job_1": 1})
+				store.HSet("maxAttempts", map[string]interface{}{"job_1": 2})
+			},
+			runs: []scriptRun{
+				{[]string{"ready", "inflight", "deliveries", "attempts", "jobs", "maxAttempts"}, []interface{}{1000, "t1"}},
+				{[]string{"ready", "inflight", "deliveries", "attempts", "jobs", "maxAttempts"}, []interface{}{2000, "t2"}},
+				{[]string{"ready", "inflight", "deliveries", "attempts", "jobs", "maxAttempts"}, []interface{}{3000, "t3"}},
+			},
+			state: []string{"ready", "inflight", "deliveries", "attempts"},
+		},
+		"requeueJobsScript": {
+			script: requeueJobsScript,
+			setup: func(store RedisStore) {
+				store.ZAdd("inflight",
+					&redis.Z{Score: 1000, Member: "job_1:t1"},
+					&redis.Z{Score: 1000, Member: "job_2:t2"},
+					&redis.Z{Score: 1000, Member: "job_3:t3"},
+					&redis.Z{Score: 9000, Member: "job_4:t4"},
+				)
+				store.HSet("deliveries", map[string]interface{}{"job_1:t1": "job_1", "job_2:t2": "job_2", "job_4:t4": "job_4"})
+				store.HSet("attempts", map[string]interface{}{"job_1": 1, "job_2": 2, "job_4": 1})
+				store.HSet("maxAttempts", map[string]interface{}{"job_1": 2, "job_2": 2, "job_4": 2})
+			},
+			runs: []scriptRun{
+				{append(inflight, "ready", "dead", "attempts", "maxAttempts"), []interface{}{5000, 100}},
+			},
+			state: []string{"inflight", "deliveries", "ready", "dead", "attempts"},
+		},
+		"settleJobScript": {
+			script: settleJobScript,
+			setup: func(store RedisStore) {
+				store.ZAdd("inflight", &redis.Z{Score: 1000, Member: "job_1:t1"}, &redis.Z{Score: 1000, Member: "job_2:t2"})
+				store.HSet("deliveries", map[string]interface{}{"job_1:t1": "job_1", "job_2:t2": "job_2"})
+				store.HSet("jobs", map[string]interface{}{"job_1": job("job_1"), "job_2": job("job_2")})
+				store.HSet("attempts", map[string]interface{}{"job_1": 1, "job_2": 1})
+				store.HSet("maxAttempts", map[string]interface{}{"job_1": 2, "job_2": 2})
+			},
+			runs: []scriptRun{
+				{append(append(inflight, "scheduled"), jobs...), []interface{}{"job_1:t1", 7000, `{"id":"job_1","lastError":"failed"}`}},
+				{append(append(inflight, "scheduled"), jobs...), []interface{}{"job_1:t1", 7000, job("job_1")}},
+				{append(append(inflight, "scheduled"), jobs...), []interface{}{"job_2:t2", 0, ""}},
+			},
+			state: append([]string{"inflight", "deliveries", "scheduled"}, jobs...),
+		},
+	}
+
+	// a script added to the package without a case here fails the test
+	declared := packageScripts(t)
+	names := []string{}
+	for name := range cases {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, declared, names)
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			redisStore, _ := newMiniRedisStore(t)
+			memoryStore := NewMemoryRedisStore()
+			c.setup(redisStore)
+			c.setup(memoryStore)
+
+			for i, run := range c.runs {
+				want, wantErr := redisStore.Eval(c.script, run.keys, run.args...)
+				got, gotErr := memoryStore.Eval(c.script, run.keys, run.args...)
+				assert.Equal(t, wantErr == nil, gotErr == nil, "run %d: %v %v", i, wantErr, gotErr)
+				if wantErr != nil {
+					assert.Equal(t, serror.Is(wantErr, serror.NOT_FOUND), serror.Is(gotErr, serror.NOT_FOUND), "run %d", i)
+					continue
+				}
+				if c.normalize != nil {
+					want, got = c.normalize(want), c.normalize(got)
+				}
+				assert.Equal(t, want, got, "run %d", i)
+			}
+			for _, key := range c.state {
+				assert.Equal(t, keySnapshot(t, redisStore, key), keySnapshot(t, memoryStore, key), key)
+			}
+		})
+	}
+}
+
+// packageScripts returns the names of the variables holding a redis.NewScript in the package sources
+func packageScripts(t *testing.T) []string {
+	files, err := filepath.Glob("*.go")
+	assert.NoError(t, err)
+
+	names := []string{}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, file, nil, 0)
+		assert.NoError(t, err)
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			spec, ok := node.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+			for i, value := range spec.Values {
+				call, ok := value.(*ast.CallExpr)
+				if !ok {
+					continue
+				}
+				if fun, ok := call.Fun.(*ast.SelectorExpr); ok && fun.Sel.Name == "NewScript" {
+					names = append(names, spec.Names[i].Name)
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// keySnapshot reads the key whatever its type, nil if it does not exist
+func keySnapshot(t *testing.T, store RedisStore, key string) interface{} {
+	count, err := store.Exists(key)
+	assert.NoError(t, err)
+	if count == 0 {
+		return nil
+	}
+	if value, err := store.Get(key); err == nil {
+		return string(value)
+	}
+	if hash, err := store.HGetAll(key); err == nil {
+		return hash
+	}
+	if members, err := store.ZRange(key, 0, -1); err == nil {
+		scores := map[string]float64{}
+		for _, member := range members {
+			scores[member], err = store.ZScore(key, member)
+			assert.NoError(t, err)
+		}
+		return scores
+	}
+	list, err := store.LRange(key, 0, -1)
+	assert.NoError(t, err)
+	return list
+}
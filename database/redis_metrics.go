@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+type RedisStats struct {
+	// Hits and Misses count the reads that found or missed their key
+	Hits   int64
+	Misses int64
+	// Pool is nil for clients without a connection pool, e.g. the in-memory client
+	Pool *redis.PoolStats
+}
+
+type redisStats struct {
+	hits   int64
+	misses int64
+}
+
+// clients with a connection pool, redis.Client and redis.ClusterClient are
+type redisPooler interface {
+	PoolStats() *redis.PoolStats
+}
+
+func (r redisStore) hit() {
+	if r.stats != nil && !r.queued() {
+		atomic.AddInt64(&r.stats.hits, 1)
+	}
+}
+
+func (r redisStore) miss() {
+	if r.stats != nil && !r.queued() {
+		atomic.AddInt64(&r.stats.misses, 1)
+	}
+}
+
+func (r redisStore) Stats() RedisStats {
+	stats := RedisStats{}
+	if r.stats != nil {
+		stats.Hits = atomic.LoadInt64(&r.stats.hits)
+		stats.Misses = atomic.LoadInt64(&r.stats.misses)
+	}
+	if pooler, ok := r.client.(redisPooler); ok {
+		stats.Pool = pooler.PoolStats()
+	}
+	return stats
+}
+
+// ReportRedisStats sends the stats of the store to dogstatsd every interval until ctx is done:
+//   - redis.hits and redis.misses as counts
+//   - redis.pool.* gauges with the connection pool stats
+func ReportRedisStats(ctx context.Context, store RedisStore, client statsd.ClientInterface, interval time.Duration, tags ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := RedisStats{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := store.Stats()
+		if err := reportRedisStats(client, stats, last, tags); err != nil {
+			log.Warn().Err(err).Msg("failed to report redis stats")
+		}
+		last = stats
+	}
+}
+
+func reportRedisStats(client statsd.ClientInterface, stats RedisStats, last RedisStats, tags []string) error {
+	if err := client.Count("redis.hits", stats.Hits-last.Hits, tags, 1); err != nil {
+		return err
+	}
+	if err := client.Count("redis.misses", stats.Misses-last.Misses, tags, 1); err != nil {
+		return err
+	}
+	if stats.Pool == nil {
+		return nil
+	}
+
+	gauges := map[string]uint32{
+		"redis.pool.hits":        stats.Pool.Hits,
+		"redis.pool.misses":      stats.Pool.Misses,
+		"redis.pool.timeouts":    stats.Pool.Timeouts,
+		"redis.pool.total_conns": stats.Pool.TotalConns,
+		"redis.pool.idle_conns":  stats.Pool.IdleConns,
+		"redis.pool.stale_conns": stats.Pool.StaleConns,
+	}
+	for name, value := range gauges {
+		if err := client.Gauge(name, float64(value), tags, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// clients able to batch commands, the go-redis clients and redis.Tx are
+type redisPipeliner interface {
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
+// clients able to WATCH keys, redis.Client and redis.ClusterClient are
+type redisWatcher interface {
+	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+}
+
+// txClient adds the Do missing from redis.Tx so it can back a RedisStore
+type txClient struct {
+	*redis.Tx
+}
+
+func (t txClient) Do(ctx context.Context, args ...interface{}) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, args...)
+	_ = t.Process(ctx, cmd)
+	return cmd
+}
+
+func (r redisStore) Pipelined(fn func(pipe RedisStore) error) error {
+	return r.pipeline(false, fn)
+}
+
+func (r redisStore) TxPipelined(fn func(pipe RedisStore) error) error {
+	return r.pipeline(true, fn)
+}
+
+func (r redisStore) pipeline(tx bool, fn func(pipe RedisStore) error) error {
+	ctx := r.context()
+	client, ok := r.client.(redisPipeliner)
+	// already in a pipeline, queue on it. The in-memory client runs commands as they are queued.
+	if r.queued() || !ok {
+		return common.StringError(fn(&r))
+	}
+
+	run := client.Pipelined
+	if tx {
+		run = client.TxPipelined
+	}
+	_, err := run(ctx, func(pipe redis.Pipeliner) error {
+		store := r
+		store.client = pipe
+		store.parent = r.client
+		return fn(&store)
+	})
+	return r.pipelineError(err)
+}
+
+// Watch does not retry, retry on TX_CONFLICT:
+//
+//	err := store.Watch(func(tx database.RedisStore) error {
+//		balance, err := tx.Get(key)
+//		...
+//		return tx.TxPipelined(func(pipe database.RedisStore) error {
+//			return pipe.Set(key, newBalance, 0)
+//		})
+//	}, key)
+func (r redisStore) Watch(fn func(tx RedisStore) error, keys ...string) error {
+	ctx := r.context()
+	client, ok := r.client.(redisWatcher)
+	if r.queued() || !ok {
+		// the in-memory client never reports conflicts
+		return common.StringError(fn(&r))
+	}
+
+	err := client.Watch(ctx, func(tx *redis.Tx) error {
+		store := r
+		store.client = txClient{tx}
+		return fn(&store)
+	}, keys...)
+	return r.pipelineError(err)
+}
+
+// queued reports whether commands are queued on a pipeline rather than run,
+// their replies are then zero values that must not be read as missing keys
+func (r redisStore) queued() bool {
+	return r.parent != nil
+}
+
+func (r redisStore) pipelineError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, redis.TxFailedErr) {
+		return common.StringError(serror.TX_CONFLICT)
+	}
+	if errors.Is(err, redis.Nil) {
+		return common.StringError(serror.NOT_FOUND)
+	}
+	if strings.HasPrefix(err.Error(), "NOSCRIPT") && r.scripts != nil {
+		// the server lost its scripts, e.g. after a restart, load them again next time
+		r.scripts.Range(func(hash, _ interface{}) bool {
+			r.scripts.Delete(hash)
+			return true
+		})
+	}
+	return common.StringError(err)
+}
+
+// queueScript queues EVALSHA, loading the script the first time since a pipeline
+// only learns the script is missing once executed, too late to fall back to EVAL
+func (r redisStore) queueScript(script *redis.Script, keys []string, args ...interface{}) error {
+	ctx := r.context()
+	// a store built without NewRedisStoreFromClient has no cache, load the script every time
+	loaded := false
+	if r.scripts != nil {
+		_, loaded = r.scripts.Load(script.Hash())
+	}
+	if !loaded {
+		if err := script.Load(ctx, r.parent).Err(); err != nil {
+			return common.StringError(err)
+		}
+		if r.scripts != nil {
+			r.scripts.Store(script.Hash(), struct{}{})
+		}
+	}
+	return common.StringError(script.EvalSha(ctx, r.client, keys, args...).Err())
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelined(t *testing.T) {
+	store, server := newMiniRedisStore(t)
+
+	err := store.Pipelined(func(pipe RedisStore) error {
+		assert.NoError(t, pipe.Set("a", "1", 0))
+		_, err := pipe.Incr("counter")
+		assert.NoError(t, err)
+		// queued replies are zero values, not missing keys
+		assert.NoError(t, pipe.Expire("missing", time.Minute))
+		_, err = pipe.TTL("missing")
+		assert.NoError(t, err)
+		_, err = pipe.Eval(releaseLockScript, []string{"lock"}, "token")
+		assert.NoError(t, err)
+
+		// nothing is sent before fn returns
+		assert.False(t, server.Exists("a"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	value, err := store.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+	count, err := store.Incr("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestTxPipelined(t *testing.T) {
+	store, server := newMiniRedisStore(t)
+
+	err := store.TxPipelined(func(pipe RedisStore) error {
+		if err := pipe.HSet("hash", map[string]interface{}{"a": 1}); err != nil {
+			return err
+		}
+		assert.False(t, server.Exists("hash"))
+		return pipe.Expire("hash", time.Minute)
+	})
+	assert.NoError(t, err)
+
+	ttl, err := store.TTL("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+}
+
+func TestWatch(t *testing.T) {
+	store, server := newMiniRedisStore(t)
+	assert.NoError(t, store.Set("balance", "10", 0))
+
+	transfer := func(concurrentWrite bool) error {
+		return store.Watch(func(tx RedisStore) error {
+			balance, err := tx.Get("balance")
+			if err != nil {
+				return err
+			}
+			if concurrentWrite {
+				server.Set("balance", "0")
+			}
+			return tx.TxPipelined(func(pipe RedisStore) error {
+				return pipe.Set("balance", string(balance)+"0", 0)
+			})
+		}, "balance")
+	}
+
+	assert.True(t, serror.Is(transfer(true), serror.TX_CONFLICT))
+	value, err := store.Get("balance")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0"), value)
+
+	assert.NoError(t, transfer(false))
+	value, err = store.Get("balance")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("00"), value)
+}
+
+func TestPipelinedScriptsWithoutCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	// a store not built by NewRedisStoreFromClient has no script cache
+	store := &redisStore{client: client}
+	assert.NoError(t, store.Set("lock", "token", 0))
+	err := store.Pipelined(func(pipe RedisStore) error {
+		_, err := pipe.Eval(releaseLockScript, []string{"lock"}, "token")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.False(t, server.Exists("lock"))
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/String-xyz/go-lib/v2/common"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+type RedisMessage struct {
+	Channel string
+	Payload string
+}
+
+// Subscription delivers the messages published on the subscribed channels
+// until it is closed or the context it was created with is done
+type Subscription struct {
+	messages  chan RedisMessage
+	done      chan struct{}
+	close     func() error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Messages is closed once the subscription is closed
+func (s *Subscription) Messages() <-chan RedisMessage {
+	return s.messages
+}
+
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closeErr = s.close()
+	})
+	return s.closeErr
+}
+
+// clients able to hold a subscription, redis.Client and redis.ClusterClient are
+type redisSubscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+func (r redisStore) Publish(channel string, message interface{}) error {
+	ctx := r.context()
+	if err := r.client.Publish(ctx, channel, message).Err(); err != nil {
+		return common.StringError(err)
+	}
+	return nil
+}
+
+func (r redisStore) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	if memory, ok := r.client.(*MemoryRedisClient); ok {
+		return memory.subscribe(ctx, channels...), nil
+	}
+
+	client, ok := r.client.(redisSubscriber)
+	if !ok {
+		return nil, common.StringError(errors.New("redis client does not support pub/sub"))
+	}
+
+	pubsub := client.Subscribe(ctx, channels...)
+	// wait for the confirmation so no message published after we return is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, common.StringError(err)
+	}
+
+	return newSubscription(ctx, pubsub.Channel(), pubsub.Close), nil
+}
+
+// newSubscription forwards incoming to the subscription until it is closed or ctx is done
+func newSubscription(ctx context.Context, incoming <-chan *redis.Message, closeFn func() error) *Subscription {
+	subscription := &Subscription{
+		messages: make(chan RedisMessage),
+		done:     make(chan struct{}),
+		close:    closeFn,
+	}
+
+	go func() {
+		defer close(subscription.messages)
+		for {
+			select {
+			case <-subscription.done:
+				return
+			case <-ctx.Done():
+				subscription.Close()
+				return
+			case msg, ok := <-incoming:
+				if !ok {
+					return
+				}
+				select {
+				case subscription.messages <- RedisMessage{Channel: msg.Channel, Payload: msg.Payload}:
+				case <-subscription.done:
+					return
+				case <-ctx.Done():
+					subscription.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	return subscription
+}
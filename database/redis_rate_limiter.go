@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const rateLimitPrefix = "ratelimit:"
+
+// sliding window log: every accepted request is a member of a sorted set scored by its
+// timestamp, members older than the window are dropped before counting.
+// The time is read from redis so clock skew between replicas does not move the window,
+// replicate_commands lets redis < 5 write after reading it.
+// returns {allowed, remaining, milliseconds until the oldest request leaves the window}
+var rateLimitScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call("time")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - window)
+local count = redis.call("zcard", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("zadd", KEYS[1], now, ARGV[3])
+	redis.call("pexpire", KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local reset = window
+local oldest = redis.call("zrange", KEYS[1], 0, 0, "withscores")
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until a slot frees up in the window
+	ResetAfter time.Duration
+}
+
+// RateLimiter allows up to limit requests per key in any sliding window,
+// the state lives in redis so it is shared by every replica
+type RateLimiter struct {
+	store  RedisStore
+	limit  int
+	window time.Duration
+}
+
+// NewRateLimiter panics unless limit is at least 1 and window at least 1ms,
+// redis would expire the state of a shorter window as soon as it is written
+func NewRateLimiter(store RedisStore, limit int, window time.Duration) *RateLimiter {
+	if limit < 1 {
+		panic("RateLimiter limit must be at least 1")
+	}
+	if window < time.Millisecond {
+		panic("RateLimiter window must be at least 1ms")
+	}
+	return &RateLimiter{
+		store:  store,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow records a request for key and reports whether it fits in the current window
+func (l *RateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	member, err := common.RandomToken(8)
+	if err != nil {
+		return RateLimitResult{}, common.StringError(err)
+	}
+
+	result, err := l.store.WithContext(ctx).Eval(rateLimitScript, []string{rateLimitPrefix + key}, l.window.Milliseconds(), l.limit, member)
+	if err != nil {
+		return RateLimitResult{}, common.StringError(err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return RateLimitResult{}, common.StringError(errors.Errorf("unexpected rate limit reply %v", result))
+	}
+	allowed, ok1 := values[0].(int64)
+	remaining, ok2 := values[1].(int64)
+	reset, ok3 := values[2].(int64)
+	if !ok1 || !ok2 || !ok3 {
+		return RateLimitResult{}, common.StringError(errors.Errorf("unexpected rate limit reply %v", result))
+	}
+	return RateLimitResult{
+		Allowed:    allowed == 1,
+		Limit:      l.limit,
+		Remaining:  int(remaining),
+		ResetAfter: time.Duration(reset) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	store, server := newMiniRedisStore(t)
+	ctx := context.Background()
+	// the window follows the clock of redis, not the one of the replica
+	now := time.Now()
+	server.SetTime(now)
+
+	limiter := NewRateLimiter(store, 2, time.Minute)
+	for i := 1; i >= 0; i-- {
+		result, err := limiter.Allow(ctx, "client")
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	server.SetTime(now.Add(30 * time.Second))
+	result, err := limiter.Allow(ctx, "client")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 2, result.Limit)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 30*time.Second, result.ResetAfter)
+
+	// other keys have their own window
+	result, err = limiter.Allow(ctx, "other")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	server.SetTime(now.Add(time.Minute + time.Second))
+	result, err = limiter.Allow(ctx, "client")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	assert.Panics(t, func() { NewRateLimiter(store, 0, time.Minute) })
+	assert.Panics(t, func() { NewRateLimiter(store, 1, time.Microsecond) })
+}
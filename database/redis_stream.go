@@ -0,0 +1,361 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+func (r redisStore) XAdd(stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	ctx := r.context()
+	id, err := r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream:       stream,
+		MaxLenApprox: maxLen,
+		Values:       values,
+	}).Result()
+	if err != nil {
+		return "", common.StringError(err)
+	}
+	return id, nil
+}
+
+func (r redisStore) XGroupCreate(stream, group, start string) error {
+	ctx := r.context()
+	err := r.client.XGroupCreateMkStream(ctx, stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return common.StringError(err)
+	}
+	return nil
+}
+
+func (r redisStore) XReadGroup(stream, group, consumer string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	ctx := r.context()
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return []redis.XMessage{}, nil
+		}
+		return nil, common.StringError(err)
+	}
+
+	messages := []redis.XMessage{}
+	for _, s := range streams {
+		messages = append(messages, s.Messages...)
+	}
+	return messages, nil
+}
+
+func (r redisStore) XAck(stream, group string, ids ...string) (int64, error) {
+	ctx := r.context()
+	acked, err := r.client.XAck(ctx, stream, group, ids...).Result()
+	if err != nil {
+		return 0, common.StringError(err)
+	}
+	return acked, nil
+}
+
+func (r redisStore) XPending(stream, group, start, end string, count int64, consumer string) ([]redis.XPendingExt, error) {
+	ctx := r.context()
+	args := []interface{}{"xpending", stream, group, start, end, count}
+	if consumer != "" {
+		args = append(args, consumer)
+	}
+	// sent with Do like XAUTOCLAIM so the in-memory client can answer it
+	reply, err := r.client.Do(ctx, args...).Result()
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	if r.queued() {
+		return nil, nil
+	}
+
+	pending, err := parseXPending(reply)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+	return pending, nil
+}
+
+// parseXPending reads [[id, consumer, idle ms, deliveries]...]
+func parseXPending(reply interface{}) ([]redis.XPendingExt, error) {
+	invalid := errors.New("invalid XPENDING reply")
+
+	entries, ok := reply.([]interface{})
+	if !ok {
+		return nil, invalid
+	}
+	pending := make([]redis.XPendingExt, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields) != 4 {
+			return nil, invalid
+		}
+		id, ok1 := fields[0].(string)
+		consumer, ok2 := fields[1].(string)
+		idle, ok3 := fields[2].(int64)
+		deliveries, ok4 := fields[3].(int64)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, invalid
+		}
+		pending = append(pending, redis.XPendingExt{
+			ID:         id,
+			Consumer:   consumer,
+			Idle:       time.Duration(idle) * time.Millisecond,
+			RetryCount: deliveries,
+		})
+	}
+	return pending, nil
+}
+
+func (r redisStore) XAutoClaim(stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redis.XMessage, string, error) {
+	ctx := r.context()
+	// go-redis v8.0.0 has no XAUTOCLAIM
+	reply, err := r.client.Do(ctx, "xautoclaim", stream, group, consumer, minIdle.Milliseconds(), start, "count", count).Result()
+	if err != nil {
+		return nil, "", common.StringError(err)
+	}
+	if r.queued() {
+		return nil, "", nil
+	}
+
+	messages, next, err := parseXAutoClaim(reply)
+	if err != nil {
+		return nil, "", common.StringError(err)
+	}
+	return messages, next, nil
+}
+
+// parseXAutoClaim reads [next cursor, [[id, [field, value...]]...], deleted ids (redis 7)]
+func parseXAutoClaim(reply interface{}) ([]redis.XMessage, string, error) {
+	invalid := errors.New("invalid XAUTOCLAIM reply")
+
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) < 2 {
+		return nil, "", invalid
+	}
+	next, ok := parts[0].(string)
+	if !ok {
+		return nil, "", invalid
+	}
+	entries, ok := parts[1].([]interface{})
+	if !ok {
+		return nil, "", invalid
+	}
+
+	messages := []redis.XMessage{}
+	for _, entry := range entries {
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields) < 2 {
+			return nil, "", invalid
+		}
+		id, ok := fields[0].(string)
+		if !ok {
+			return nil, "", invalid
+		}
+		// entries trimmed from the stream are claimed with no values
+		pairs, _ := fields[1].([]interface{})
+		values := make(map[string]interface{}, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return nil, "", invalid
+			}
+			values[key] = pairs[i+1]
+		}
+		messages = append(messages, redis.XMessage{ID: id, Values: values})
+	}
+	return messages, next, nil
+}
+
+// StreamHandler processes one stream entry, returning an error leaves the entry pending
+// so it is retried once it has been idle for ClaimMinIdle, up to MaxDeliveries times
+type StreamHandler func(ctx context.Context, message redis.XMessage) error
+
+type StreamWorkerOptions struct {
+	Stream   string
+	Group    string
+	Consumer string
+	// Count is how many entries are read at once, defaults to 10
+	Count int64
+	// Block is how long a read waits for new entries, defaults to 2 seconds
+	Block time.Duration
+	// ClaimMinIdle is how long an entry stays pending before being reclaimed, defaults to 1 minute
+	ClaimMinIdle time.Duration
+	// ClaimInterval is how often pending entries are reclaimed, defaults to 30 seconds
+	ClaimInterval time.Duration
+	// MaxDeliveries is how many times an entry is handled before it is moved to the dead letter
+	// stream, defaults to 5, a negative value retries forever
+	MaxDeliveries int64
+	// DeadLetterStream receives the entries that failed MaxDeliveries times, along with their
+	// "original_id" and "deliveries", defaults to Stream + ":dead"
+	DeadLetterStream string
+}
+
+// StreamWorker consumes a stream as a member of a consumer group, entries are
+// acknowledged once handled, entries abandoned by dead consumers are reclaimed and
+// entries that keep failing are dead lettered
+type StreamWorker struct {
+	store   RedisStore
+	options StreamWorkerOptions
+	handler StreamHandler
+}
+
+func NewStreamWorker(store RedisStore, options StreamWorkerOptions, handler StreamHandler) *StreamWorker {
+	if options.Count == 0 {
+		options.Count = 10
+	}
+	if options.Block == 0 {
+		options.Block = 2 * time.Second
+	}
+	if options.ClaimMinIdle == 0 {
+		options.ClaimMinIdle = time.Minute
+	}
+	if options.ClaimInterval == 0 {
+		options.ClaimInterval = 30 * time.Second
+	}
+	if options.MaxDeliveries == 0 {
+		options.MaxDeliveries = 5
+	}
+	if options.DeadLetterStream == "" {
+		options.DeadLetterStream = options.Stream + ":dead"
+	}
+	return &StreamWorker{store: store, options: options, handler: handler}
+}
+
+// Run consumes the stream until ctx is done. The entry being handled when ctx is
+// cancelled is finished, the rest of the batch stays pending for another consumer.
+func (w *StreamWorker) Run(ctx context.Context) error {
+	store := w.store.WithContext(ctx)
+	if err := store.XGroupCreate(w.options.Stream, w.options.Group, "0"); err != nil {
+		return common.StringError(err)
+	}
+
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= w.options.ClaimInterval {
+			lastClaim = time.Now()
+			if err := w.reclaim(ctx); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("stream", w.options.Stream).Msg("failed to reclaim pending entries")
+			}
+		}
+
+		messages, err := store.XReadGroup(w.options.Stream, w.options.Group, w.options.Consumer, w.options.Count, w.options.Block)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Error().Err(err).Str("stream", w.options.Stream).Msg("failed to read stream")
+			sleep(ctx, w.options.Block)
+			continue
+		}
+		w.handle(ctx, messages)
+	}
+
+	return nil
+}
+
+// reclaim takes over the entries other consumers left pending for too long
+func (w *StreamWorker) reclaim(ctx context.Context) error {
+	store := w.store.WithContext(ctx)
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := store.XAutoClaim(w.options.Stream, w.options.Group, w.options.Consumer, w.options.ClaimMinIdle, start, w.options.Count)
+		if err != nil {
+			return common.StringError(err)
+		}
+		messages, err = w.deadLetter(ctx, messages)
+		if err != nil {
+			return common.StringError(err)
+		}
+		w.handle(ctx, messages)
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+	return nil
+}
+
+// deadLetter moves the claimed entries delivered more than MaxDeliveries times to the
+// dead letter stream and returns the ones left to handle
+func (w *StreamWorker) deadLetter(ctx context.Context, messages []redis.XMessage) ([]redis.XMessage, error) {
+	if w.options.MaxDeliveries < 0 || len(messages) == 0 {
+		return messages, nil
+	}
+
+	// looked up one by one, a range could be filled by other entries pending in between
+	store := w.store.WithContext(ctx)
+	deliveries := make(map[string]int64, len(messages))
+	for _, message := range messages {
+		pending, err := store.XPending(w.options.Stream, w.options.Group, message.ID, message.ID, 1, w.options.Consumer)
+		if err != nil {
+			return nil, common.StringError(err)
+		}
+		if len(pending) == 1 {
+			deliveries[message.ID] = pending[0].RetryCount
+		}
+	}
+
+	remaining := []redis.XMessage{}
+	for _, message := range messages {
+		// claiming counts as a delivery, so an entry handled MaxDeliveries times is now past it
+		count := deliveries[message.ID]
+		if count <= w.options.MaxDeliveries {
+			remaining = append(remaining, message)
+			continue
+		}
+
+		values := make(map[string]interface{}, len(message.Values)+2)
+		for field, value := range message.Values {
+			values[field] = value
+		}
+		values["original_id"] = message.ID
+		values["deliveries"] = count - 1
+		if _, err := store.XAdd(w.options.DeadLetterStream, values, 0); err != nil {
+			return nil, common.StringError(err)
+		}
+		if _, err := store.XAck(w.options.Stream, w.options.Group, message.ID); err != nil {
+			return nil, common.StringError(err)
+		}
+		log.Warn().Str("stream", w.options.Stream).Str("id", message.ID).Int64("deliveries", count-1).Msg("stream entry dead lettered")
+	}
+	return remaining, nil
+}
+
+func (w *StreamWorker) handle(ctx context.Context, messages []redis.XMessage) {
+	for _, message := range messages {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := w.handler(ctx, message); err != nil {
+			log.Error().Err(err).Str("stream", w.options.Stream).Str("id", message.ID).Msg("failed to handle stream entry")
+			continue
+		}
+		// not bound to ctx, an entry handled during shutdown must still be acknowledged
+		if _, err := w.store.XAck(w.options.Stream, w.options.Group, message.ID); err != nil {
+			log.Error().Err(err).Str("stream", w.options.Stream).Str("id", message.ID).Msg("failed to ack stream entry")
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamWorker(t *testing.T) {
+	redisStore, _ := newMiniRedisStore(t)
+	for name, store := range map[string]RedisStore{"redis": redisStore, "memory": NewMemoryRedisStore()} {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.XAdd("events", map[string]interface{}{"kind": "good"}, 0)
+			assert.NoError(t, err)
+			badId, err := store.XAdd("events", map[string]interface{}{"kind": "bad"}, 0)
+			assert.NoError(t, err)
+
+			mu := sync.Mutex{}
+			handled := map[string]int{}
+			worker := NewStreamWorker(store, StreamWorkerOptions{
+				Stream:        "events",
+				Group:         "workers",
+				Consumer:      "worker_1",
+				Block:         10 * time.Millisecond,
+				ClaimMinIdle:  20 * time.Millisecond,
+				ClaimInterval: 10 * time.Millisecond,
+				MaxDeliveries: 2,
+			}, func(ctx context.Context, message redis.XMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				kind := message.Values["kind"].(string)
+				handled[kind]++
+				if kind == "bad" {
+					return errors.New("cannot handle " + kind)
+				}
+				return nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				assert.NoError(t, worker.Run(ctx))
+			}()
+
+			assert.NoError(t, store.XGroupCreate("events:dead", "inspect", "0"))
+			var dead []redis.XMessage
+			assert.Eventually(t, func() bool {
+				messages, err := store.XReadGroup("events:dead", "inspect", "test", 10, -1)
+				assert.NoError(t, err)
+				dead = append(dead, messages...)
+				return len(dead) > 0
+			}, 5*time.Second, 10*time.Millisecond)
+			cancel()
+			<-done
+
+			assert.Len(t, dead, 1)
+			assert.Equal(t, "bad", dead[0].Values["kind"])
+			assert.Equal(t, badId, dead[0].Values["original_id"])
+			assert.Equal(t, "2", dead[0].Values["deliveries"])
+			assert.Equal(t, map[string]int{"good": 1, "bad": 2}, handled)
+
+			// nothing is left pending
+			pending, err := store.XPending("events", "workers", "-", "+", 10, "")
+			assert.NoError(t, err)
+			assert.Empty(t, pending)
+		})
+	}
+}
+
+func TestStreamWorkerDeadLetterOwnEntries(t *testing.T) {
+	redisStore, _ := newMiniRedisStore(t)
+	for name, store := range map[string]RedisStore{"redis": redisStore, "memory": NewMemoryRedisStore()} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.XGroupCreate("events", "workers", "0"))
+			ids := []string{}
+			for i := 0; i < 3; i++ {
+				id, err := store.XAdd("events", map[string]interface{}{"n": i}, 0)
+				assert.NoError(t, err)
+				ids = append(ids, id)
+			}
+			_, err := store.XReadGroup("events", "workers", "worker_1", 10, -1)
+			assert.NoError(t, err)
+			claimed, _, err := store.XAutoClaim("events", "workers", "worker_1", 0, "0", 10)
+			assert.NoError(t, err)
+			assert.Len(t, claimed, 3)
+			// the entry in the middle is now pending for another consumer
+			_, _, err = store.XAutoClaim("events", "workers", "worker_2", 0, ids[1], 1)
+			assert.NoError(t, err)
+
+			worker := NewStreamWorker(store, StreamWorkerOptions{Stream: "events", Group: "workers", Consumer: "worker_1", MaxDeliveries: 1}, nil)
+			remaining, err := worker.deadLetter(context.Background(), []redis.XMessage{claimed[0], claimed[2]})
+			assert.NoError(t, err)
+			assert.Empty(t, remaining)
+
+			pending, err := store.XPending("events", "workers", "-", "+", 10, "")
+			assert.NoError(t, err)
+			assert.Len(t, pending, 1)
+			assert.Equal(t, "worker_2", pending[0].Consumer)
+		})
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	store, _ := newMiniRedisStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	subscription, err := store.Subscribe(ctx, "events")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Publish("events", "hello"))
+	assert.Equal(t, RedisMessage{Channel: "events", Payload: "hello"}, <-subscription.Messages())
+
+	// the subscription ends with its context
+	cancel()
+	_, open := <-subscription.Messages()
+	assert.False(t, open)
+}
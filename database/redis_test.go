@@ -0,0 +1,263 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMiniRedisStore runs the store against a real go-redis client talking to
+// an in-process redis server, Lua scripts included
+func newMiniRedisStore(t *testing.T) (RedisStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStoreFromClient(client), server
+}
+
+var oneRetry, noRetries = 1, 0
+
+// nothing listens on port 1, so every ping fails right away
+var unreachable = RedisConfigOptions{Host: "127.0.0.1", Port: "1", ConnectRetries: &oneRetry, ConnectBackoff: time.Millisecond}
+
+func TestOpenRedisStoreUnreachable(t *testing.T) {
+	store, err := OpenRedisStore(unreachable)
+	assert.Error(t, err)
+	assert.Nil(t, store)
+}
+
+func TestOpenRedisStoreNoRetries(t *testing.T) {
+	options := unreachable
+	options.ConnectRetries = &noRetries
+	// a retry would wait for the backoff
+	options.ConnectBackoff = time.Hour
+	_, err := OpenRedisStore(options)
+	assert.Error(t, err)
+}
+
+func TestOpenRedisStoreLazy(t *testing.T) {
+	options := unreachable
+	options.LazyConnect = true
+	store, err := OpenRedisStore(options)
+	assert.NoError(t, err)
+	assert.Error(t, store.Healthy(context.Background()))
+}
+
+func TestRedisAddrs(t *testing.T) {
+	assert.Equal(t, []string{"redis:6379"}, redisAddrs(RedisConfigOptions{Host: "redis", Port: "6379"}))
+	seeds := []string{"node1:6379", "node2:6379"}
+	assert.Equal(t, seeds, redisAddrs(RedisConfigOptions{Host: "redis", Port: "6379", Addrs: seeds}))
+}
+
+func TestRedisTLSConf(t *testing.T) {
+	t.Setenv("ENV", "local")
+	tlsCf, err := redisTLSConf(RedisConfigOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsCf)
+
+	t.Setenv("ENV", "dev")
+	tlsCf, err = redisTLSConf(RedisConfigOptions{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	assert.True(t, tlsCf.InsecureSkipVerify)
+
+	tlsCf, err = redisTLSConf(RedisConfigOptions{DisableTLS: true})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsCf)
+
+	_, err = redisTLSConf(RedisConfigOptions{CACert: "not a certificate"})
+	assert.Error(t, err)
+}
+
+func TestClusterOptionsDefaults(t *testing.T) {
+	options := clusterOptions(RedisConfigOptions{Host: "redis", Port: "6379", Username: "app"}, nil)
+	assert.Equal(t, 10, options.PoolSize)
+	assert.Equal(t, 10, options.MinIdleConns)
+	assert.Equal(t, "app", options.Username)
+
+	options = clusterOptions(RedisConfigOptions{PoolSize: 50}, nil)
+	assert.Equal(t, 50, options.PoolSize)
+}
+
+func TestNewRedisClientModes(t *testing.T) {
+	t.Setenv("ENV", "local")
+	_, err := newRedisClient(RedisConfigOptions{ClusterMode: true, SentinelMode: true})
+	assert.Error(t, err)
+
+	client, err := newRedisClient(RedisConfigOptions{SentinelMode: true, SentinelMasterName: "master", SentinelAddrs: []string{"sentinel:26379"}, DB: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.(*redis.Client).Options().DB)
+
+	// options the mode would ignore are rejected
+	for name, options := range map[string]RedisConfigOptions{
+		"cluster db":          {ClusterMode: true, DB: 2},
+		"standalone addrs":    {Addrs: []string{"redis-1:6379", "redis-2:6379"}},
+		"sentinel no master":  {SentinelMode: true, SentinelAddrs: []string{"sentinel:26379"}},
+		"sentinel no address": {SentinelMode: true, SentinelMasterName: "master"},
+	} {
+		_, err = newRedisClient(options)
+		assert.Error(t, err, name)
+	}
+
+	_, err = newRedisClient(RedisConfigOptions{ClusterMode: true, Addrs: []string{"redis-1:6379", "redis-2:6379"}})
+	assert.NoError(t, err)
+	_, err = newRedisClient(RedisConfigOptions{Addrs: []string{"redis-1:6379"}, DB: 2})
+	assert.NoError(t, err)
+}
+
+func TestTraceOptions(t *testing.T) {
+	t.Setenv("SERVICE_NAME", "api")
+	assert.Len(t, traceOptions(RedisConfigOptions{}), 2)
+	t.Setenv("SERVICE_NAME", "")
+	assert.Len(t, traceOptions(RedisConfigOptions{}), 1)
+}
+
+func TestRedisStats(t *testing.T) {
+	store := NewMemoryRedisStore()
+	store.Set("a", 1, 0)
+
+	store.Get("a")
+	store.Get("b")
+	store.MGet("a", "b", "c")
+
+	stats := store.Stats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(3), stats.Misses)
+	assert.Nil(t, stats.Pool)
+
+	client, err := newRedisClient(unreachable)
+	assert.NoError(t, err)
+	assert.NotNil(t, NewRedisStoreFromClient(client).Stats().Pool)
+}
+
+// the same commands against redis and the memory store, which must agree
+func TestRedisStoreCommands(t *testing.T) {
+	redisStore, _ := newMiniRedisStore(t)
+	for name, store := range map[string]RedisStore{"redis": redisStore, "memory": NewMemoryRedisStore()} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("counters", func(t *testing.T) {
+				value, err := store.Incr("counter")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), value)
+				value, err = store.IncrBy("counter", 10)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(11), value)
+				value, err = store.Decr("counter")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(10), value)
+				value, err = store.DecrBy("counter", 4)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(6), value)
+			})
+
+			t.Run("expiration", func(t *testing.T) {
+				assert.True(t, serror.Is(store.Expire("missing", time.Minute), serror.NOT_FOUND))
+				_, err := store.TTL("missing")
+				assert.True(t, serror.Is(err, serror.NOT_FOUND))
+				assert.True(t, serror.Is(store.Persist("missing"), serror.NOT_FOUND))
+
+				assert.NoError(t, store.Set("expiring", "value", 0))
+				ttl, err := store.TTL("expiring")
+				assert.NoError(t, err)
+				assert.Less(t, ttl, time.Duration(0))
+				assert.NoError(t, store.Persist("expiring"))
+
+				assert.NoError(t, store.Expire("expiring", time.Minute))
+				ttl, err = store.TTL("expiring")
+				assert.NoError(t, err)
+				assert.Equal(t, time.Minute, ttl)
+				assert.NoError(t, store.Persist("expiring"))
+				ttl, err = store.TTL("expiring")
+				assert.NoError(t, err)
+				assert.Less(t, ttl, time.Duration(0))
+
+				count, err := store.Exists("expiring", "missing")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), count)
+			})
+
+			t.Run("mget", func(t *testing.T) {
+				assert.NoError(t, store.MSet(map[string]interface{}{"a": "1", "b": "2"}))
+				values, err := store.MGet("a", "b", "c")
+				assert.NoError(t, err)
+				assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, values)
+			})
+
+			t.Run("sets", func(t *testing.T) {
+				added, err := store.SAdd("set", "a", "b", "a")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), added)
+				ok, err := store.SIsMember("set", "a")
+				assert.NoError(t, err)
+				assert.True(t, ok)
+				removed, err := store.SRem("set", "a", "c")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), removed)
+				members, err := store.SMembers("set")
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"b"}, members)
+				count, err := store.SCard("set")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), count)
+			})
+
+			t.Run("sorted sets", func(t *testing.T) {
+				added, err := store.ZAdd("zset", &redis.Z{Score: 3, Member: "c"}, &redis.Z{Score: 1, Member: "a"}, &redis.Z{Score: 2, Member: "b"})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), added)
+				score, err := store.ZScore("zset", "b")
+				assert.NoError(t, err)
+				assert.Equal(t, float64(2), score)
+				_, err = store.ZScore("zset", "missing")
+				assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+				members, err := store.ZRange("zset", 0, -1)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"a", "b", "c"}, members)
+				members, err = store.ZRangeByScore("zset", &redis.ZRangeBy{Min: "(1", Max: "3", Count: 1})
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"b"}, members)
+
+				removed, err := store.ZRemRangeByScore("zset", "-inf", "1")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), removed)
+				removed, err = store.ZRem("zset", "b")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), removed)
+				count, err := store.ZCard("zset")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), count)
+			})
+
+			t.Run("lists", func(t *testing.T) {
+				_, err := store.RPop("list")
+				assert.True(t, serror.Is(err, serror.NOT_FOUND))
+
+				length, err := store.RPush("list", "b", "c", "b")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), length)
+				length, err = store.LPush("list", "a")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), length)
+
+				removed, err := store.LRem("list", 0, "b")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), removed)
+				values, err := store.LRange("list", 0, -1)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"a", "c"}, values)
+
+				value, err := store.RPop("list")
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("c"), value)
+				length, err = store.LLen("list")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), length)
+			})
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/database"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	RolloutByUser     = "user"
+	RolloutByPlatform = "platform"
+)
+
+type Flag struct {
+	Name string `json:"name"`
+	// Enabled turns the flag on for everyone
+	Enabled bool `json:"enabled"`
+	// Platforms and Users always get the flag
+	Platforms []string `json:"platforms,omitempty"`
+	Users     []string `json:"users,omitempty"`
+	// Percentage, from 0 to 100, of the users or platforms, per RolloutBy, getting the flag.
+	// The same ids stay in the rollout as the percentage grows.
+	Percentage int `json:"percentage,omitempty"`
+	// RolloutBy is RolloutByUser or RolloutByPlatform, defaults to RolloutByUser
+	RolloutBy string    `json:"rolloutBy,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Target is who a flag is evaluated for, either id may be empty
+type Target struct {
+	PlatformId string
+	UserId     string
+}
+
+// EnabledFor reports whether target gets the flag
+func (f Flag) EnabledFor(target Target) bool {
+	if f.Enabled {
+		return true
+	}
+	if target.PlatformId != "" && contains(f.Platforms, target.PlatformId) {
+		return true
+	}
+	if target.UserId != "" && contains(f.Users, target.UserId) {
+		return true
+	}
+
+	id := target.UserId
+	if f.RolloutBy == RolloutByPlatform {
+		id = target.PlatformId
+	}
+	if id == "" || f.Percentage <= 0 {
+		return false
+	}
+	return bucket(f.Name, id) < f.Percentage
+}
+
+// bucket places id in one of 100 buckets, salted with the flag name so
+// the same ids are not the first to get every flag
+func bucket(name string, id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + id))
+	return int(h.Sum32() % 100)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	// Key is the redis hash holding the flags, one field per flag, defaults to "featureflags"
+	Key string
+	// RefreshInterval is how long flags are served from memory before being reloaded, defaults to 30 seconds
+	RefreshInterval time.Duration
+}
+
+// Store evaluates flags from a copy kept in memory, reloaded from redis every
+// RefreshInterval, so checking a flag does not cost a round trip.
+// A flag that does not exist is disabled.
+type Store struct {
+	redis   database.RedisStore
+	options Options
+
+	mu         sync.RWMutex
+	flags      map[string]Flag
+	loadedAt   time.Time
+	failedAt   time.Time
+	refreshing int32
+}
+
+// loadRetryInterval is how long flags stay disabled after failing to load them
+// before IsEnabled goes back to redis
+const loadRetryInterval = time.Second
+
+func NewStore(redis database.RedisStore, options Options) *Store {
+	if options.Key == "" {
+		options.Key = "featureflags"
+	}
+	if options.RefreshInterval == 0 {
+		options.RefreshInterval = 30 * time.Second
+	}
+	return &Store{redis: redis, options: options, flags: map[string]Flag{}}
+}
+
+// IsEnabled reports whether target gets the flag. Flags are loaded on the first call and
+// then reloaded in the background once stale, if redis is down the last known flags are used.
+func (s *Store) IsEnabled(ctx context.Context, name string, target Target) bool {
+	s.mu.RLock()
+	flag, ok := s.flags[name]
+	loadedAt := s.loadedAt
+	failedAt := s.failedAt
+	s.mu.RUnlock()
+
+	if loadedAt.IsZero() {
+		if time.Since(failedAt) < loadRetryInterval {
+			return false
+		}
+		if err := s.Refresh(ctx); err != nil {
+			s.mu.Lock()
+			s.failedAt = time.Now()
+			s.mu.Unlock()
+			log.Warn().Err(err).Str("flag", name).Msg("failed to load feature flags")
+			return false
+		}
+		return s.IsEnabled(ctx, name, target)
+	}
+	if time.Since(loadedAt) > s.options.RefreshInterval && atomic.CompareAndSwapInt32(&s.refreshing, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&s.refreshing, 0)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := s.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to refresh feature flags")
+			}
+		}()
+	}
+
+	return ok && flag.EnabledFor(target)
+}
+
+// Refresh reloads every flag from redis
+func (s *Store) Refresh(ctx context.Context) error {
+	fields, err := s.redis.WithContext(ctx).HGetAll(s.options.Key)
+	if err != nil && !serror.Is(err, serror.NOT_FOUND) {
+		return common.StringError(err)
+	}
+
+	flags := make(map[string]Flag, len(fields))
+	for name, data := range fields {
+		flag := Flag{}
+		if err := json.Unmarshal([]byte(data), &flag); err != nil {
+			log.Warn().Err(err).Str("flag", name).Msg("ignoring malformed feature flag")
+			continue
+		}
+		flag.Name = name
+		flags[name] = flag
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every flag from redis, sorted by name
+func (s *Store) List(ctx context.Context) ([]Flag, error) {
+	if err := s.Refresh(ctx); err != nil {
+		return nil, common.StringError(err)
+	}
+
+	s.mu.RLock()
+	flags := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		flags = append(flags, flag)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+// Save creates or replaces the flag, other replicas see it after their RefreshInterval
+func (s *Store) Save(ctx context.Context, flag Flag) error {
+	if flag.RolloutBy == "" {
+		flag.RolloutBy = RolloutByUser
+	}
+	if flag.RolloutBy != RolloutByUser && flag.RolloutBy != RolloutByPlatform {
+		return common.StringError(serror.INVALID_DATA, "unknown rollout "+flag.RolloutBy)
+	}
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		return common.StringError(serror.INVALID_DATA, "percentage must be between 0 and 100")
+	}
+	flag.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return common.StringError(err)
+	}
+	if err := s.redis.WithContext(ctx).HSet(s.options.Key, map[string]interface{}{flag.Name: string(data)}); err != nil {
+		return common.StringError(err)
+	}
+	return common.StringError(s.Refresh(ctx))
+}
+
+// Delete removes the flag, which is then disabled for everyone
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if _, err := s.redis.WithContext(ctx).HDel(s.options.Key, name); err != nil {
+		return common.StringError(err)
+	}
+	return common.StringError(s.Refresh(ctx))
+}
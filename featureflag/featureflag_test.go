@@ -0,0 +1,104 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/String-xyz/go-lib/v2/database"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// downRedis fails every load, counting them
+type downRedis struct {
+	database.RedisStore
+	loads int32
+}
+
+func (r *downRedis) WithContext(ctx context.Context) database.RedisStore {
+	return r
+}
+
+func (r *downRedis) HGetAll(key string) (map[string]string, error) {
+	atomic.AddInt32(&r.loads, 1)
+	return nil, errors.New("connection refused")
+}
+
+func TestPercentageRollout(t *testing.T) {
+	flag := Flag{Name: "checkout", Percentage: 30}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		target := Target{UserId: fmt.Sprint("user", i)}
+		if flag.EnabledFor(target) {
+			enabled++
+			// growing the rollout keeps the users already in it
+			assert.True(t, Flag{Name: "checkout", Percentage: 50}.EnabledFor(target))
+		}
+	}
+	assert.InDelta(t, 300, enabled, 60)
+
+	assert.False(t, flag.EnabledFor(Target{}))
+	platformFlag := Flag{Name: "checkout", Percentage: 100, RolloutBy: RolloutByPlatform}
+	assert.False(t, platformFlag.EnabledFor(Target{UserId: "user"}))
+	assert.True(t, platformFlag.EnabledFor(Target{PlatformId: "platform"}))
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(database.NewMemoryRedisStore(), Options{})
+	ctx := context.Background()
+
+	assert.False(t, store.IsEnabled(ctx, "checkout", Target{PlatformId: "a"}))
+	assert.NoError(t, store.Save(ctx, Flag{Name: "checkout", Platforms: []string{"a"}}))
+	assert.True(t, store.IsEnabled(ctx, "checkout", Target{PlatformId: "a"}))
+	assert.False(t, store.IsEnabled(ctx, "checkout", Target{PlatformId: "b"}))
+
+	err := store.Save(ctx, Flag{Name: "checkout", Percentage: 101})
+	assert.True(t, serror.Is(err, serror.INVALID_DATA))
+
+	flags, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, flags, 1)
+
+	assert.NoError(t, store.Delete(ctx, "checkout"))
+	assert.False(t, store.IsEnabled(ctx, "checkout", Target{PlatformId: "a"}))
+}
+
+func TestStoreLoadFailure(t *testing.T) {
+	redis := &downRedis{}
+	store := NewStore(redis, Options{})
+
+	// the flags are off and redis is not retried on every check
+	for i := 0; i < 10; i++ {
+		assert.False(t, store.IsEnabled(context.Background(), "checkout", Target{PlatformId: "a"}))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&redis.loads))
+}
+
+func TestRequire(t *testing.T) {
+	store := NewStore(database.NewMemoryRedisStore(), Options{})
+	store.Save(context.Background(), Flag{Name: "beta", Platforms: []string{"a"}})
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, Require(store, "beta"))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("platformId", c.Request().Header.Get("X-Platform"))
+			return next(c)
+		}
+	})
+
+	for platform, status := range map[string]int{"a": http.StatusOK, "b": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Platform", platform)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, status, rec.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package featureflag
+
+import (
+	"github.com/String-xyz/go-lib/v2/httperror"
+	"github.com/String-xyz/go-lib/v2/session"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TargetFunc tells who the request is made for
+type TargetFunc func(c echo.Context) Target
+
+// DefaultTarget uses the "platformId" set in the echo context by middleware.APIKeyAuth or
+// middleware.JWT and the user of the session, if any
+func DefaultTarget(c echo.Context) Target {
+	target := Target{}
+	target.PlatformId, _ = c.Get("platformId").(string)
+	if s, ok := session.FromContext(c); ok {
+		target.UserId = s.UserId
+	}
+	return target
+}
+
+// IsEnabledFor reports whether the flag is on for the current request, per DefaultTarget
+func (s *Store) IsEnabledFor(c echo.Context, name string) bool {
+	return s.IsEnabled(c.Request().Context(), name, DefaultTarget(c))
+}
+
+// Require hides the routes it guards behind a 404 unless the flag is on for the request,
+// target defaults to DefaultTarget
+func Require(store *Store, name string, target ...TargetFunc) echo.MiddlewareFunc {
+	targetFunc := DefaultTarget
+	if len(target) > 0 && target[0] != nil {
+		targetFunc = target[0]
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !store.IsEnabled(c.Request().Context(), name, targetFunc(c)) {
+				return httperror.NotFound404(c)
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package httperror
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/String-xyz/go-lib/v2/validator"
+	govalidator "github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrorMapping answers errors that are Err, or wrap it, with Status
+type ErrorMapping struct {
+	Err    error
+	Status int
+}
+
+// DefaultErrorMappings maps the stringerror sentinels, anything else is a 500
+var DefaultErrorMappings = []ErrorMapping{
+	{serror.NOT_FOUND, http.StatusNotFound},
+	{serror.FORBIDDEN, http.StatusForbidden},
+	{serror.DEACTIVATED, http.StatusForbidden},
+	{serror.FUNC_NOT_ALLOWED, http.StatusForbidden},
+	{serror.CONTRACT_NOT_ALLOWED, http.StatusForbidden},
+	{serror.INVALID_PASSWORD, http.StatusUnauthorized},
+	{serror.UNKNOWN_DEVICE, http.StatusUnauthorized},
+	{serror.INVALID_RESET_TOKEN, http.StatusBadRequest},
+	{serror.EXPIRED, http.StatusBadRequest},
+	{serror.INVALID_DATA, http.StatusBadRequest},
+	{serror.ALREADY_IN_USE, http.StatusConflict},
+	{serror.TX_CONFLICT, http.StatusConflict},
+	{serror.LOCK_NOT_ACQUIRED, http.StatusConflict},
+}
+
+// codes of the statuses answered by the helpers of this package
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          "BAD_REQUEST",
+	http.StatusUnauthorized:        "UNAUTHORIZED",
+	http.StatusForbidden:           "FORBIDDEN",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusMethodNotAllowed:    "NOT_ALLOWED",
+	http.StatusConflict:            "CONFLICT",
+	http.StatusUnprocessableEntity: "UNPROCESSABLE_ENTITY",
+	http.StatusTooManyRequests:     "TOO_MANY_REQUESTS",
+	http.StatusInternalServerError: "INTERNAL_SERVER",
+}
+
+type ErrorHandlerConfig struct {
+	// Mappings are checked before DefaultErrorMappings
+	Mappings []ErrorMapping
+}
+
+// ErrorHandler answers every error returned by handlers with a JSONError, use it as
+//
+//	e.HTTPErrorHandler = httperror.ErrorHandler()
+func ErrorHandler() echo.HTTPErrorHandler {
+	return ErrorHandlerWithConfig(ErrorHandlerConfig{})
+}
+
+// ErrorHandlerWithConfig maps validation errors to a 400, echo errors to their status and
+// stringerror sentinels per the mappings. 5xx errors are logged and, outside the local env,
+// answered without their message so internals do not leak.
+func ErrorHandlerWithConfig(config ErrorHandlerConfig) echo.HTTPErrorHandler {
+	mappings := append(append([]ErrorMapping{}, config.Mappings...), DefaultErrorMappings...)
+
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		status, body := toJSONError(err, mappings)
+		if status >= http.StatusInternalServerError {
+			logError(c, err)
+			if !common.IsLocalEnv() {
+				body.Message = "Something went wrong"
+			}
+		} else {
+			log.Debug().Err(err).Int("status", status).Msg("request failed")
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(status)
+		} else {
+			err = c.JSON(status, body)
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to write error response")
+		}
+	}
+}
+
+func toJSONError(err error, mappings []ErrorMapping) (int, JSONError) {
+	var validationErrors govalidator.ValidationErrors
+	if errors.As(err, &validationErrors) && len(validationErrors) > 0 {
+		params := validator.ExtractErrorParams(validationErrors)
+		return http.StatusBadRequest, JSONError{Code: "BAD_REQUEST", Message: params[0].Message, Details: &Details{Params: &params}}
+	}
+
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		message := fmt.Sprint(httpError.Message)
+		if httpError.Internal != nil && common.IsLocalEnv() {
+			message += ": " + httpError.Internal.Error()
+		}
+		return httpError.Code, JSONError{Code: statusCode(httpError.Code), Message: message}
+	}
+
+	for _, mapping := range mappings {
+		if isError(err, mapping.Err) {
+			message := mapping.Err.Error()
+			if common.IsLocalEnv() {
+				message = err.Error()
+			}
+			return mapping.Status, JSONError{Code: statusCode(mapping.Status), Message: message}
+		}
+	}
+
+	return http.StatusInternalServerError, JSONError{Code: statusCode(http.StatusInternalServerError), Message: err.Error()}
+}
+
+// isError matches target by identity, or by the whole message of the cause since
+// common.StringError rebuilds the errors it wraps. Unlike stringerror.Is, an error that
+// merely mentions "not found" in its text is not a match.
+func isError(err error, target error) bool {
+	return errors.Is(err, target) || errors.Cause(err).Error() == target.Error()
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// logError goes through common.LogStringError when the Logger middleware is used, which it needs
+func logError(c echo.Context, err error) {
+	if _, ok := c.Get("logger").(*zerolog.Logger); ok {
+		common.LogStringError(c, err, "unhandled error")
+		return
+	}
+	log.Error().Stack().Err(err).Str("method", c.Request().Method).Str("path", c.Path()).Msg("unhandled error")
+}
@@ -0,0 +1,100 @@
+package httperror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/String-xyz/go-lib/v2/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	t.Setenv("ENV", "prod")
+	insufficientFunds := errors.New("insufficient funds")
+
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandlerWithConfig(ErrorHandlerConfig{
+		Mappings: []ErrorMapping{{insufficientFunds, http.StatusUnprocessableEntity}},
+	})
+	e.GET("/error", func(c echo.Context) error {
+		switch c.QueryParam("err") {
+		case "not_found":
+			return common.StringError(serror.NOT_FOUND, "user usr_1")
+		case "conflict":
+			return common.StringError(serror.ALREADY_IN_USE)
+		case "funds":
+			return common.StringError(insufficientFunds)
+		case "validation":
+			return validator.New().Validate(struct {
+				Email string `json:"email" validate:"required"`
+			}{})
+		case "wrapped":
+			return errors.Wrap(serror.EXPIRED, "reset token")
+		case "db":
+			return common.StringError(errors.New(`pq: relation "users" not found`))
+		case "echo":
+			return echo.NewHTTPError(http.StatusTooManyRequests, "slow down")
+		default:
+			return errors.New("pq: connection refused")
+		}
+	})
+
+	serve := func(method string, path string) (int, JSONError) {
+		req := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		body := JSONError{}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	status, body := serve(http.MethodGet, "/error?err=not_found")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, JSONError{Code: "NOT_FOUND", Message: "not found"}, body)
+
+	status, body = serve(http.MethodGet, "/error?err=conflict")
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "CONFLICT", body.Code)
+
+	status, body = serve(http.MethodGet, "/error?err=funds")
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "UNPROCESSABLE_ENTITY", body.Code)
+
+	status, body = serve(http.MethodGet, "/error?err=wrapped")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, JSONError{Code: "BAD_REQUEST", Message: "expired"}, body)
+
+	// errors mentioning a sentinel in their text are not that sentinel
+	status, body = serve(http.MethodGet, "/error?err=db")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, "INTERNAL_SERVER", body.Code)
+
+	status, body = serve(http.MethodGet, "/error?err=validation")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "email", (*body.Details.Params)[0].Param)
+
+	status, body = serve(http.MethodGet, "/error?err=echo")
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, JSONError{Code: "TOO_MANY_REQUESTS", Message: "slow down"}, body)
+
+	status, body = serve(http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "NOT_FOUND", body.Code)
+
+	// internals are hidden outside the local env
+	status, body = serve(http.MethodGet, "/error")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, JSONError{Code: "INTERNAL_SERVER", Message: "Something went wrong"}, body)
+
+	t.Setenv("ENV", "local")
+	_, body = serve(http.MethodGet, "/error")
+	assert.Equal(t, "pq: connection refused", body.Message)
+	_, body = serve(http.MethodGet, "/error?err=not_found")
+	assert.Contains(t, body.Message, "user usr_1")
+}
@@ -79,3 +79,17 @@ func NotAllowed405(c echo.Context, message ...string) error {
 	}
 	return c.JSON(http.StatusMethodNotAllowed, JSONError{Message: "Not Allowed", Code: "NOT_ALLOWED"})
 }
+
+func TooManyRequests429(c echo.Context, message ...string) error {
+	if len(message) > 0 {
+		return c.JSON(http.StatusTooManyRequests, JSONError{Message: strings.Join(message, " "), Code: "TOO_MANY_REQUESTS"})
+	}
+	return c.JSON(http.StatusTooManyRequests, JSONError{Message: "Too many requests", Code: "TOO_MANY_REQUESTS"})
+}
+
+func PayloadTooLarge413(c echo.Context, message ...string) error {
+	if len(message) > 0 {
+		return c.JSON(http.StatusRequestEntityTooLarge, JSONError{Message: strings.Join(message, " "), Code: "PAYLOAD_TOO_LARGE"})
+	}
+	return c.JSON(http.StatusRequestEntityTooLarge, JSONError{Message: "Payload too large", Code: "PAYLOAD_TOO_LARGE"})
+}
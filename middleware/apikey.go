@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/database"
+	"github.com/String-xyz/go-lib/v2/httperror"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const apiKeyPrefix = "apikey:"
+
+type apiKeyContextKey struct{}
+
+// APIKey is what the middleware needs to know about a key, never the key itself
+type APIKey struct {
+	Id            string     `json:"id"`
+	PlatformId    string     `json:"platformId"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+}
+
+// APIKeyStore looks keys up by their common.ToSha256 hash, so raw keys are never stored
+type APIKeyStore interface {
+	// GetByHash returns NOT_FOUND if no key has the hash
+	GetByHash(ctx context.Context, hash string) (APIKey, error)
+}
+
+// CachedAPIKeyStore keeps the keys found by another store in redis for a while,
+// so most requests do not hit the database
+type CachedAPIKeyStore struct {
+	store APIKeyStore
+	redis database.RedisStore
+	ttl   time.Duration
+	// unknown hashes are cached too so random keys do not go to the database every time
+	missingTTL time.Duration
+}
+
+// NewCachedAPIKeyStore caches the keys of store for ttl, defaults to 5 minutes
+func NewCachedAPIKeyStore(store APIKeyStore, redis database.RedisStore, ttl time.Duration) *CachedAPIKeyStore {
+	if ttl == 0 {
+		ttl = 5 * time.Minute
+	}
+	return &CachedAPIKeyStore{store: store, redis: redis, ttl: ttl, missingTTL: 30 * time.Second}
+}
+
+func (s *CachedAPIKeyStore) GetByHash(ctx context.Context, hash string) (APIKey, error) {
+	redis := s.redis.WithContext(ctx)
+	data, err := redis.Get(apiKeyPrefix + hash)
+	if err == nil {
+		key := APIKey{}
+		if err := json.Unmarshal(data, &key); err == nil {
+			if key.Id == "" {
+				return key, common.StringError(serror.NOT_FOUND)
+			}
+			return key, nil
+		}
+	} else if !serror.Is(err, serror.NOT_FOUND) {
+		log.Warn().Err(err).Msg("failed to read cached api key")
+	}
+
+	key, err := s.store.GetByHash(ctx, hash)
+	ttl := s.ttl
+	if serror.Is(err, serror.NOT_FOUND) {
+		ttl = s.missingTTL
+	} else if err != nil {
+		return key, common.StringError(err)
+	}
+
+	data, _ = json.Marshal(key)
+	if err := redis.Set(apiKeyPrefix+hash, data, ttl); err != nil {
+		log.Warn().Err(err).Msg("failed to cache api key")
+	}
+	if key.Id == "" {
+		return key, common.StringError(serror.NOT_FOUND)
+	}
+	return key, nil
+}
+
+// Invalidate drops the cached key, e.g. once it is deactivated, so it stops working right away
+func (s *CachedAPIKeyStore) Invalidate(ctx context.Context, hash string) error {
+	return common.StringError(s.redis.WithContext(ctx).Delete(apiKeyPrefix + hash))
+}
+
+type APIKeyConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	Store   APIKeyStore
+	// Header carrying the key, defaults to X-Api-Key
+	Header string
+}
+
+// APIKeyAuth requires a valid api key in the X-Api-Key header
+func APIKeyAuth(store APIKeyStore) echo.MiddlewareFunc {
+	return APIKeyAuthWithConfig(APIKeyConfig{Store: store})
+}
+
+// APIKeyAuthWithConfig looks the hashed key up and puts it, and its platform as "platformId",
+// in the echo context and the request context, see APIKeyFromContext.
+// Missing or unknown keys get a 401, deactivated keys a 403.
+func APIKeyAuthWithConfig(config APIKeyConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.Header == "" {
+		config.Header = "X-Api-Key"
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			raw := c.Request().Header.Get(config.Header)
+			if raw == "" {
+				return httperror.Unauthorized401(c, "Missing API key")
+			}
+
+			ctx := c.Request().Context()
+			key, err := config.Store.GetByHash(ctx, common.ToSha256(raw))
+			if serror.Is(err, serror.NOT_FOUND) {
+				return httperror.Unauthorized401(c, "Invalid API key")
+			}
+			if err != nil {
+				log.Error().Err(err).Msg("failed to look up api key")
+				return httperror.Internal500(c)
+			}
+			if key.DeactivatedAt != nil && !key.DeactivatedAt.After(time.Now()) {
+				return httperror.Forbidden403(c, "API key is deactivated")
+			}
+
+			c.Set("apiKey", &key)
+			c.Set("platformId", key.PlatformId)
+			c.SetRequest(c.Request().WithContext(context.WithValue(ctx, apiKeyContextKey{}, &key)))
+			LoggerWith(c, func(l zerolog.Context) zerolog.Context {
+				return l.Str("principal", key.Id).Str("platform_id", key.PlatformId)
+			})
+			return next(c)
+		}
+	}
+}
+
+// APIKeyFromContext returns the key authenticated by the middleware
+func APIKeyFromContext(c echo.Context) (*APIKey, bool) {
+	key, ok := c.Get("apiKey").(*APIKey)
+	return key, ok
+}
+
+// APIKeyFromRequestContext returns the key authenticated by the middleware, for code
+// that only has access to the request context
+func APIKeyFromRequestContext(ctx context.Context) (*APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key, ok
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/database"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type apiKeyMap struct {
+	keys    map[string]APIKey
+	lookups int
+}
+
+func (m *apiKeyMap) GetByHash(ctx context.Context, hash string) (APIKey, error) {
+	m.lookups++
+	key, ok := m.keys[hash]
+	if !ok {
+		return key, serror.NOT_FOUND
+	}
+	return key, nil
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	deactivated := time.Now().Add(-time.Hour)
+	keys := &apiKeyMap{keys: map[string]APIKey{
+		common.ToSha256("valid"):       {Id: "key_1", PlatformId: "platform_1"},
+		common.ToSha256("deactivated"): {Id: "key_2", PlatformId: "platform_1", DeactivatedAt: &deactivated},
+	}}
+	store := NewCachedAPIKeyStore(keys, database.NewMemoryRedisStore(), 0)
+
+	e := echo.New()
+	e.Use(APIKeyAuth(store))
+	e.GET("/", func(c echo.Context) error {
+		key, ok := APIKeyFromContext(c)
+		assert.True(t, ok)
+		assert.Equal(t, "key_1", key.Id)
+		_, ok = APIKeyFromRequestContext(c.Request().Context())
+		assert.True(t, ok)
+		assert.Equal(t, "platform_1", c.Get("platformId"))
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("valid"))
+	assert.Equal(t, http.StatusOK, serve("valid"))
+	assert.Equal(t, http.StatusUnauthorized, serve(""))
+	assert.Equal(t, http.StatusUnauthorized, serve("unknown"))
+	assert.Equal(t, http.StatusUnauthorized, serve("unknown"))
+	assert.Equal(t, http.StatusForbidden, serve("deactivated"))
+	// valid and unknown were each looked up once, then served from redis
+	assert.Equal(t, 3, keys.lookups)
+
+	assert.NoError(t, store.Invalidate(context.Background(), common.ToSha256("valid")))
+	assert.Equal(t, http.StatusOK, serve("valid"))
+	assert.Equal(t, 4, keys.lookups)
+}
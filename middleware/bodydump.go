@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const redacted = "[REDACTED]"
+
+// DefaultRedactKeys match, case insensitively, the json keys of credentials and PII
+var DefaultRedactKeys = []string{
+	"password", "passcode", "secret", "token", "authorization", "api_?key", "cvc", "cvv",
+	"card_?number", "^pan$", "^ssn$", "email", "phone",
+}
+
+type BodyDumpConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	// Routes are the route templates dumped, e.g. /payments/:id
+	Routes []string
+	// ErrorStatus dumps every route answering with this status or above, e.g. 400.
+	// Without Routes and ErrorStatus every request going through the middleware is dumped.
+	ErrorStatus int
+	// MaxSize is how many bytes of each body are captured, defaults to 4KB.
+	// Larger bodies cannot be redacted so only their size is logged.
+	MaxSize int
+	// RedactKeys are regexps, matched case insensitively, of the json keys whose values are
+	// redacted at any depth, defaults to DefaultRedactKeys
+	RedactKeys []string
+	// RedactStructs are request and response types, e.g. CardRequest{}, whose fields tagged
+	// `redact:"true"` are redacted by json name, along with the fields of their nested structs
+	RedactStructs []interface{}
+}
+
+// BodyDump logs the request and response bodies of the given routes, redacted per DefaultRedactKeys
+func BodyDump(routes ...string) echo.MiddlewareFunc {
+	return BodyDumpWithConfig(BodyDumpConfig{Routes: routes})
+}
+
+// BodyDumpWithConfig logs the redacted request and response bodies with the request logger set by
+// the Logger middleware, falling back to the global logger. Only JSON bodies are logged, other
+// content types could hold anything so only their size is. Meant for debugging integrations,
+// keep it to the routes that need it.
+func BodyDumpWithConfig(config BodyDumpConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = 4 << 10
+	}
+	if config.RedactKeys == nil {
+		config.RedactKeys = DefaultRedactKeys
+	}
+	routes := map[string]bool{}
+	for _, route := range config.Routes {
+		routes[route] = true
+	}
+	redactor := newRedactor(config.RedactKeys, config.RedactStructs)
+	selected := func(c echo.Context, status int) bool {
+		if len(routes) == 0 && config.ErrorStatus == 0 {
+			return true
+		}
+		return routes[c.Path()] || (config.ErrorStatus != 0 && status >= config.ErrorStatus)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// the status is not known yet, only skip what no status can select
+			if config.Skipper(c) || (config.ErrorStatus == 0 && !selected(c, 0)) {
+				return next(c)
+			}
+
+			// keep the start of the body for the log and hand the whole of it to the handler
+			req := c.Request()
+			reqBody := []byte{}
+			reqSize := 0
+			if req.Body != nil {
+				var err error
+				reqBody, err = io.ReadAll(io.LimitReader(req.Body, int64(config.MaxSize)+1))
+				if err != nil {
+					return err
+				}
+				reqSize = len(reqBody)
+				req.Body = readCloser{io.MultiReader(bytes.NewReader(reqBody), req.Body), req.Body}
+			}
+
+			res := c.Response()
+			recorder := &responseRecorder{ResponseWriter: res.Writer, body: new(bytes.Buffer), limit: config.MaxSize + 1}
+			res.Writer = recorder
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response so it is dumped too
+				c.Error(err)
+			}
+			res.Writer = recorder.ResponseWriter
+
+			if !selected(c, res.Status) {
+				return err
+			}
+			if reqSize > config.MaxSize && req.ContentLength > 0 {
+				reqSize = int(req.ContentLength)
+			}
+
+			logger, ok := c.Get("logger").(*zerolog.Logger)
+			if !ok {
+				logger = &log.Logger
+			}
+			event := logger.Info().Str("path", req.URL.Path).Int("status_code", res.Status)
+			event = redactor.field(event, "request_body", req.Header.Get(echo.HeaderContentType), reqBody, reqSize, config.MaxSize)
+			event = redactor.field(event, "response_body", res.Header().Get(echo.HeaderContentType), recorder.body.Bytes(), recorder.size, config.MaxSize)
+			event.Msg("body dump")
+			return err
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// redactor replaces the values of sensitive json keys
+type redactor struct {
+	patterns []*regexp.Regexp
+	keys     map[string]bool
+}
+
+func newRedactor(patterns []string, structs []interface{}) *redactor {
+	r := &redactor{keys: map[string]bool{}}
+	for _, pattern := range patterns {
+		r.patterns = append(r.patterns, regexp.MustCompile("(?i)"+pattern))
+	}
+	for _, s := range structs {
+		r.addTagged(reflect.TypeOf(s), map[reflect.Type]bool{})
+	}
+	return r
+}
+
+// addTagged collects the json names of the fields tagged `redact:"true"`
+func (r *redactor) addTagged(t reflect.Type, seen map[reflect.Type]bool) {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" {
+			name = field.Name
+		}
+		if redact, _ := strconv.ParseBool(field.Tag.Get("redact")); redact && name != "-" {
+			r.keys[name] = true
+		}
+		r.addTagged(field.Type, seen)
+	}
+}
+
+func (r *redactor) sensitive(key string) bool {
+	if r.keys[key] {
+		return true
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if r.sensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = r.redact(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.redact(child)
+		}
+	}
+	return value
+}
+
+// field adds the redacted body to event, or only its size when it cannot be redacted
+func (r *redactor) field(event *zerolog.Event, name string, contentType string, body []byte, size int, maxSize int) *zerolog.Event {
+	if len(body) == 0 {
+		return event
+	}
+	if size > maxSize || !strings.HasPrefix(contentType, echo.MIMEApplicationJSON) {
+		return event.Int(name+"_size", size)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return event.Int(name+"_size", size)
+	}
+	data, err := json.Marshal(r.redact(value))
+	if err != nil {
+		return event.Int(name+"_size", size)
+	}
+	return event.RawJSON(name, data)
+}
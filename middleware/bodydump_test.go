@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type cardRequest struct {
+	Holder  string `json:"holder"`
+	Expiry  string `json:"expiry" redact:"true"`
+	Billing struct {
+		Street string `json:"street" redact:"true"`
+	} `json:"billing"`
+}
+
+func TestBodyDump(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := zerolog.New(out)
+
+	e := echo.New()
+	e.Use(Logger(&logger), BodyDumpWithConfig(BodyDumpConfig{
+		Routes:        []string{"/cards"},
+		ErrorStatus:   http.StatusBadRequest,
+		MaxSize:       256,
+		RedactStructs: []interface{}{cardRequest{}},
+	}))
+	e.POST("/cards", func(c echo.Context) error {
+		request := cardRequest{}
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": "card_1", "holder": request.Holder, "token": "tok_1"})
+	})
+	e.POST("/users", func(c echo.Context) error {
+		if c.QueryParam("fail") != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid email")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(path string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	lastDump := func() map[string]interface{} {
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		fields := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &fields))
+		return fields
+	}
+
+	// the handler still gets the whole body
+	code := serve("/cards", `{"holder":"Jane","cardNumber":"4242424242424242","cvv":"123","expiry":"12/30","billing":{"street":"1 Main St","city":"Denver"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	fields := lastDump()
+	assert.Equal(t, map[string]interface{}{
+		"holder": "Jane", "cardNumber": redacted, "cvv": redacted, "expiry": redacted,
+		"billing": map[string]interface{}{"street": redacted, "city": "Denver"},
+	}, fields["request_body"])
+	assert.Equal(t, map[string]interface{}{"id": "card_1", "holder": "Jane", "token": redacted}, fields["response_body"])
+
+	// other routes are only dumped when they fail
+	out.Reset()
+	assert.Equal(t, http.StatusOK, serve("/users", `{"email":"jane@string.xyz"}`))
+	assert.Empty(t, out.String())
+	assert.Equal(t, http.StatusBadRequest, serve("/users?fail=1", `{"email":"jane@string.xyz","name":"Jane"}`))
+	fields = lastDump()
+	assert.Equal(t, map[string]interface{}{"email": redacted, "name": "Jane"}, fields["request_body"])
+	assert.Equal(t, map[string]interface{}{"message": "invalid email"}, fields["response_body"])
+
+	// bodies over the cap cannot be redacted
+	out.Reset()
+	large := `{"holder":"` + strings.Repeat("a", 300) + `"}`
+	assert.Equal(t, http.StatusOK, serve("/cards", large))
+	fields = lastDump()
+	assert.NotContains(t, fields, "request_body")
+	assert.Equal(t, float64(len(large)), fields["request_body_size"])
+}
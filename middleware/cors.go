@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+)
+
+var errCORSWildcard = errors.New("CORS cannot allow every origin along with credentials, list the allowed origins instead")
+
+type CORSConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	// AllowOrigins are exact origins, e.g. https://app.string.xyz, or patterns where * stands
+	// for any subdomain, e.g. https://*.string.xyz, or any port, e.g. http://localhost:*.
+	// A lone * allows every origin and cannot be combined with AllowCredentials.
+	AllowOrigins []string
+	// AllowOriginsEnv names the env var with more comma separated origins, defaults to CORS_ALLOW_ORIGINS
+	AllowOriginsEnv string
+	// AllowMethods defaults to GET, PUT, POST, DELETE and PATCH
+	AllowMethods []string
+	// AllowHeaders defaults to the headers read by this library's middlewares
+	AllowHeaders []string
+	// ExposeHeaders defaults to the headers set by this library's middlewares
+	ExposeHeaders []string
+	// AllowCredentials lets the browser send cookies
+	AllowCredentials bool
+	// MaxAge is how long, in seconds, browsers may cache a preflight response, defaults to 10 minutes
+	MaxAge int
+}
+
+// DefaultCORSConfig allows cookie auth from the origins listed in CORS_ALLOW_ORIGINS,
+// and from localhost on any port in the local env
+var DefaultCORSConfig = CORSConfig{
+	AllowCredentials: true,
+}
+
+// CORS allows cookie auth from the origins listed in CORS_ALLOW_ORIGINS,
+// and from localhost on any port in the local env
+func CORS() echo.MiddlewareFunc {
+	return CORSWithConfig(DefaultCORSConfig)
+}
+
+// CORSWithConfig only answers with the request origin when it is allowed, it panics
+// if no origin is allowed, which outside the local env means setting CORS_ALLOW_ORIGINS
+// or AllowOrigins, or if every origin is allowed along with credentials
+func CORSWithConfig(config CORSConfig) echo.MiddlewareFunc {
+	if config.AllowOriginsEnv == "" {
+		config.AllowOriginsEnv = "CORS_ALLOW_ORIGINS"
+	}
+	origins := append([]string{}, config.AllowOrigins...)
+	for _, origin := range strings.Split(os.Getenv(config.AllowOriginsEnv), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if common.IsLocalEnv() {
+		origins = append(origins, "http://localhost:*", "http://127.0.0.1:*")
+	}
+	if len(origins) == 0 {
+		panic("CORS allows no origin, set " + config.AllowOriginsEnv + " or AllowOrigins")
+	}
+
+	if config.AllowMethods == nil {
+		config.AllowMethods = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch}
+	}
+	if config.AllowHeaders == nil {
+		config.AllowHeaders = []string{
+			echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization,
+			echo.HeaderXRequestID, "X-Api-Key", "Idempotency-Key",
+		}
+	}
+	if config.ExposeHeaders == nil {
+		config.ExposeHeaders = []string{
+			echo.HeaderXRequestID, echo.HeaderRetryAfter, "X-RateLimit-Limit", "X-RateLimit-Remaining",
+			"X-RateLimit-Reset", "Idempotent-Replayed",
+		}
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = 600
+	}
+
+	allowOrigin, err := originMatcher(origins, config.AllowCredentials)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
+		Skipper:          config.Skipper,
+		AllowOriginFunc:  allowOrigin,
+		AllowMethods:     config.AllowMethods,
+		AllowHeaders:     config.AllowHeaders,
+		ExposeHeaders:    config.ExposeHeaders,
+		AllowCredentials: config.AllowCredentials,
+		MaxAge:           config.MaxAge,
+	})
+}
+
+// originMatcher compiles the allowed origins into the check used by echo
+func originMatcher(origins []string, credentials bool) (func(origin string) (bool, error), error) {
+	exact := map[string]bool{}
+	patterns := []*regexp.Regexp{}
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			if credentials {
+				return nil, errCORSWildcard
+			}
+			return func(string) (bool, error) { return true, nil }, nil
+		case strings.Contains(origin, "*"):
+			patterns = append(patterns, originPattern(origin))
+		default:
+			exact[origin] = true
+		}
+	}
+
+	return func(origin string) (bool, error) {
+		origin = strings.ToLower(origin)
+		if exact[origin] {
+			return true, nil
+		}
+		for _, pattern := range patterns {
+			if pattern.MatchString(origin) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, nil
+}
+
+// originPattern turns https://*.string.xyz into a regexp matching any subdomain
+// and http://localhost:* into one matching any port
+func originPattern(origin string) *regexp.Regexp {
+	parts := strings.Split(origin, "*")
+	pattern := "^" + regexp.QuoteMeta(parts[0])
+	for i, part := range parts[1:] {
+		if strings.HasSuffix(parts[i], ":") {
+			pattern += `[0-9]+`
+		} else {
+			pattern += `[a-z0-9-]+(\.[a-z0-9-]+)*`
+		}
+		pattern += regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile(pattern + "$")
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	allowed, err := originMatcher([]string{"https://app.string.xyz/", "https://*.string.dev", "http://localhost:*"}, true)
+	assert.NoError(t, err)
+
+	for origin, ok := range map[string]bool{
+		"https://app.string.xyz":       true,
+		"https://APP.string.xyz":       true,
+		"https://a.b.string.dev":       true,
+		"https://string.dev":           false,
+		"https://evilstring.dev":       false,
+		"https://a.string.dev.evil.io": false,
+		"http://localhost:3000":        true,
+		"http://localhost:3000.evil":   false,
+		"http://app.string.xyz":        false,
+	} {
+		match, _ := allowed(origin)
+		assert.Equal(t, ok, match, origin)
+	}
+
+	_, err = originMatcher([]string{"*"}, true)
+	assert.Error(t, err)
+}
+
+func TestCORS(t *testing.T) {
+	t.Setenv("ENV", "prod")
+	t.Setenv("CORS_ALLOW_ORIGINS", "https://app.string.xyz, https://dashboard.string.xyz")
+
+	e := echo.New()
+	e.Use(CORS())
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	for origin, allowed := range map[string]string{
+		"https://dashboard.string.xyz": "https://dashboard.string.xyz",
+		"https://evil.io":              "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderOrigin, origin)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, allowed, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	}
+
+	assert.Panics(t, func() { CORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}) })
+
+	// outside the local env an unset origin list is a misconfiguration
+	t.Setenv("CORS_ALLOW_ORIGINS", "")
+	assert.PanicsWithValue(t, "CORS allows no origin, set CORS_ALLOW_ORIGINS or AllowOrigins", func() { CORS() })
+	t.Setenv("ENV", "local")
+	assert.NotPanics(t, func() { CORS() })
+}
@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/database"
+	"github.com/String-xyz/go-lib/v2/httperror"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const idempotencyPrefix = "idempotency:"
+
+const (
+	idempotencyInFlight  = "in_flight"
+	idempotencyCompleted = "completed"
+)
+
+type IdempotencyConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	Store   database.RedisStore
+	// Header carrying the key, defaults to Idempotency-Key
+	Header string
+	// Methods the middleware applies to, defaults to POST and PATCH
+	Methods []string
+	// Required rejects requests without a key with a 400
+	Required bool
+	// TTL is how long a completed response is replayed, defaults to 24 hours
+	TTL time.Duration
+	// LockTTL bounds how long an in flight request holds its key if its replica dies,
+	// defaults to 1 minute. The key is extended every LockTTL/2 while the handler runs.
+	LockTTL time.Duration
+	// MaxBodySize is the largest request body fingerprinted, larger requests are
+	// rejected with a 413, defaults to 1MB
+	MaxBodySize int64
+	// ScopeFunc namespaces keys so clients can't replay each other's responses,
+	// defaults to the authenticated Principal. Anonymous requests share a single scope.
+	ScopeFunc func(c echo.Context) string
+}
+
+type idempotencyRecord struct {
+	Status      string      `json:"status"`
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"statusCode,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of what is written to the response, up to limit bytes if set
+type responseRecorder struct {
+	http.ResponseWriter
+	body  *bytes.Buffer
+	limit int
+	// size is how many bytes were written, kept or not
+	size int
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.size += len(b)
+	if w.limit == 0 {
+		w.body.Write(b)
+	} else if room := w.limit - w.body.Len(); room > 0 {
+		if len(b) > room {
+			w.body.Write(b[:room])
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Idempotency makes mutating endpoints safe to retry with the given store
+func Idempotency(store database.RedisStore) echo.MiddlewareFunc {
+	return IdempotencyWithConfig(IdempotencyConfig{Store: store})
+}
+
+// IdempotencyWithConfig stores the response of a request under its Idempotency-Key
+// and replays it when the same request is retried with the same key by the same client.
+// Add it after the authentication middleware so keys are scoped to the caller.
+// Reusing a key with a different request is rejected with a 422 and retrying while
+// the first request is still being processed is rejected with a 409.
+// Handlers that fail with an error or a 5xx release the key so the request can be retried.
+func IdempotencyWithConfig(config IdempotencyConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.Header == "" {
+		config.Header = "Idempotency-Key"
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if config.TTL == 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.LockTTL == 0 {
+		config.LockTTL = time.Minute
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	if config.ScopeFunc == nil {
+		config.ScopeFunc = Principal
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || !contains(config.Methods, c.Request().Method) {
+				return next(c)
+			}
+
+			key := c.Request().Header.Get(config.Header)
+			if key == "" {
+				if config.Required {
+					return httperror.BadRequest400(c, config.Header, "header is required")
+				}
+				return next(c)
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, config.MaxBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					return httperror.PayloadTooLarge413(c, "request body is too large")
+				}
+				return httperror.BadRequest400(c, "unable to read request body")
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			redisKey := idempotencyPrefix + config.ScopeFunc(c) + ":" + common.ToSha256(key)
+			fingerprint := common.ToSha256(c.Request().Method + " " + c.Request().URL.Path + "\n" + string(body))
+			store := config.Store.WithContext(c.Request().Context())
+
+			inFlight, err := json.Marshal(idempotencyRecord{Status: idempotencyInFlight, Fingerprint: fingerprint})
+			if err != nil {
+				return common.StringError(err)
+			}
+			ok, err := store.SetNX(redisKey, string(inFlight), config.LockTTL)
+			if err != nil {
+				// without redis we can't guarantee the request runs once, so don't run it
+				log.Error().Err(err).Msg("idempotency store unavailable")
+				return httperror.Internal500(c)
+			}
+			if !ok {
+				return replay(c, store, redisKey, fingerprint)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer, body: new(bytes.Buffer)}
+			c.Response().Writer = recorder
+
+			stopRenewal := renewIdempotencyKey(store, redisKey, config.LockTTL)
+			err = next(c)
+			stopRenewal()
+			status := c.Response().Status
+			// the client may be gone by now, settle the key regardless
+			store = config.Store.WithContext(context.Background())
+			if err != nil || status >= http.StatusInternalServerError {
+				if delErr := store.Delete(redisKey); delErr != nil {
+					log.Warn().Err(delErr).Msg("failed to release idempotency key")
+				}
+				return err
+			}
+
+			completed, marshalErr := json.Marshal(idempotencyRecord{
+				Status:      idempotencyCompleted,
+				Fingerprint: fingerprint,
+				StatusCode:  status,
+				Header:      c.Response().Header().Clone(),
+				Body:        recorder.body.Bytes(),
+			})
+			if marshalErr == nil {
+				marshalErr = store.Set(redisKey, string(completed), config.TTL)
+			}
+			if marshalErr != nil {
+				log.Error().Err(marshalErr).Msg("failed to save idempotent response")
+			}
+
+			return nil
+		}
+	}
+}
+
+// renewIdempotencyKey extends the in flight key every ttl/2 so a duplicate can't run
+// while a slow handler is still going, the returned func stops the renewal
+func renewIdempotencyKey(store database.RedisStore, redisKey string, ttl time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := store.Expire(redisKey, ttl); err != nil {
+					log.Warn().Err(err).Msg("failed to extend idempotency key")
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		// don't let a late renewal race the release or the saved response
+		<-stopped
+	}
+}
+
+// replay answers a request whose key was already used
+func replay(c echo.Context, store database.RedisStore, redisKey, fingerprint string) error {
+	data, err := store.Get(redisKey)
+	if err != nil {
+		if serror.Is(err, serror.NOT_FOUND) {
+			// the first request just released the key
+			return httperror.Conflict409(c, "A request with this idempotency key is being processed")
+		}
+		log.Error().Err(err).Msg("idempotency store unavailable")
+		return httperror.Internal500(c)
+	}
+
+	record := idempotencyRecord{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return common.StringError(err)
+	}
+
+	if record.Fingerprint != fingerprint {
+		return httperror.Unprocessable422(c, "This idempotency key was already used with a different request")
+	}
+	if record.Status == idempotencyInFlight {
+		return httperror.Conflict409(c, "A request with this idempotency key is being processed")
+	}
+
+	header := c.Response().Header()
+	for name, values := range record.Header {
+		// the replay is a new request with its own id
+		if name == echo.HeaderXRequestID {
+			continue
+		}
+		header[name] = values
+	}
+	header.Set("Idempotent-Replayed", "true")
+	c.Response().WriteHeader(record.StatusCode)
+	_, err = c.Response().Write(record.Body)
+	return err
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/database"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	var runs int32
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	e := echo.New()
+	e.Use(IdempotencyWithConfig(IdempotencyConfig{
+		Store:       database.NewMemoryRedisStore(),
+		LockTTL:     50 * time.Millisecond,
+		MaxBodySize: 64,
+	}))
+	e.POST("/payments", func(c echo.Context) error {
+		atomic.AddInt32(&runs, 1)
+		body := make([]byte, 64)
+		n, _ := c.Request().Body.Read(body)
+		switch string(body[:n]) {
+		case "fail":
+			return errors.New("payment provider unavailable")
+		case "slow":
+			close(started)
+			<-finish
+		}
+		return c.String(http.StatusCreated, "pay_"+string(body[:n]))
+	})
+
+	serve := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// the retry gets the saved response without running the handler again
+	rec := serve("key_1", "1")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve("key_1", "1")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "pay_1", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	// reusing the key for another request
+	assert.Equal(t, http.StatusUnprocessableEntity, serve("key_1", "2").Code)
+
+	// the key is held past LockTTL while the handler runs
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, http.StatusCreated, serve("key_2", "slow").Code)
+	}()
+	<-started
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, http.StatusConflict, serve("key_2", "slow").Code)
+	close(finish)
+	wg.Wait()
+	rec = serve("key_2", "slow")
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+
+	// failures release the key so the request can be retried
+	assert.Equal(t, http.StatusInternalServerError, serve("key_3", "fail").Code)
+	assert.Equal(t, http.StatusInternalServerError, serve("key_3", "fail").Code)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&runs))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve("key_4", strings.Repeat("a", 65)).Code)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&runs))
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	var runs int32
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("apiKey", &APIKey{Id: c.Request().Header.Get("X-Api-Key")})
+			return next(c)
+		}
+	})
+	e.Use(Idempotency(database.NewMemoryRedisStore()))
+	e.POST("/payments", func(c echo.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return c.String(http.StatusCreated, "pay_"+c.Request().Header.Get("X-Api-Key"))
+	})
+
+	serve := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("1"))
+		req.Header.Set("Idempotency-Key", "key_1")
+		req.Header.Set("X-Api-Key", apiKey)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, "pay_a", serve("a").Body.String())
+	// another client reusing the key gets its own response
+	rec := serve("b")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "pay_b", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "true", serve("a").Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/pkg/errors"
+)
+
+// how often an unknown kid may trigger a reload, so forged kids cannot hammer the source
+const jwksMinReload = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet holds the public keys of a JWKS read from a file or a URL,
+// reloaded every refresh or when a token is signed with an unknown key
+type keySet struct {
+	file    string
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	loading     sync.Mutex
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+}
+
+func newKeySet(file string, url string, refresh time.Duration) *keySet {
+	return &keySet{
+		file:    file,
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		keys:    map[string]crypto.PublicKey{},
+	}
+}
+
+// key returns the key with the kid, or the only key of the set if kid is empty
+func (s *keySet) key(kid string) (crypto.PublicKey, error) {
+	key, ok, stale, throttled := s.state(kid)
+	if ok && (!stale || throttled) {
+		return key, nil
+	}
+	if throttled {
+		return nil, errors.New("unknown key " + kid)
+	}
+
+	s.loading.Lock()
+	defer s.loading.Unlock()
+	// another request may have reloaded while we waited
+	if _, _, _, throttled := s.state(kid); !throttled {
+		if err := s.load(); err != nil && !ok {
+			return nil, common.StringError(err)
+		}
+	}
+
+	// on error keep verifying with the last known keys while the source is down
+	if key, ok, _, _ := s.state(kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown key " + kid)
+}
+
+func (s *keySet) state(kid string) (key crypto.PublicKey, ok bool, stale bool, throttled bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok = s.lookup(kid)
+	stale = time.Since(s.loadedAt) > s.refresh
+	throttled = time.Since(s.attemptedAt) < jwksMinReload
+	return key, ok, stale, throttled
+}
+
+// lookup must be called with mu held
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *keySet) load() error {
+	s.mu.Lock()
+	s.attemptedAt = time.Now()
+	s.mu.Unlock()
+
+	data, err := s.read()
+	if err != nil {
+		return common.StringError(err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return common.StringError(err)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *keySet) read() ([]byte, error) {
+	if s.file != "" {
+		return os.ReadFile(s.file)
+	}
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetching %s: unexpected status %d", s.url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS reads the RSA and P-256 signing keys of a JWKS document
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, common.StringError(err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, common.StringError(err, "key "+jwk.Kid)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns nil for key types we do not verify with
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return key, nil
+	default:
+		return nil, nil
+	}
+}
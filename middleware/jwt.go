@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/httperror"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type claimsContextKey struct{}
+
+// Audience reads the aud claim, which is either a string or a list of strings
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Id        string   `json:"jti,omitempty"`
+
+	PlatformId string   `json:"platformId,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	// Custom holds every claim of the token, the ones above included
+	Custom map[string]interface{} `json:"-"`
+}
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type claims Claims
+	if err := json.Unmarshal(data, (*claims)(c)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.Custom)
+}
+
+// Valid only checks exp and nbf, the middleware also checks aud and iss with some leeway
+func (c *Claims) Valid() error {
+	return c.validate(time.Now(), 0, "", "")
+}
+
+func (c *Claims) validate(now time.Time, leeway time.Duration, issuer string, audience string) error {
+	if c.ExpiresAt != 0 && now.Add(-leeway).Unix() >= c.ExpiresAt {
+		return errors.New("token is expired")
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Unix() < c.NotBefore {
+		return errors.New("token is not valid yet")
+	}
+	if issuer != "" && c.Issuer != issuer {
+		return errors.New("unexpected issuer " + c.Issuer)
+	}
+	if audience != "" && !contains(c.Audience, audience) {
+		return errors.New("token is not meant for " + audience)
+	}
+	return nil
+}
+
+type JWTConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	// Secret verifies HS256 tokens
+	Secret []byte
+	// JWKSFile or JWKSURL hold the public keys verifying RS256 and ES256 tokens, picked by kid
+	JWKSFile string
+	JWKSURL  string
+	// JWKSRefresh is how often the JWKS is reloaded, defaults to 1 hour
+	JWKSRefresh time.Duration
+	// Issuer and Audience, when set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew on exp and nbf, defaults to 30 seconds
+	Leeway time.Duration
+	// AllowNoExpiration accepts tokens without exp, which never expire
+	AllowNoExpiration bool
+	// Optional lets requests without a token through, invalid tokens are still rejected
+	Optional bool
+}
+
+// JWT requires a bearer token signed with secret, use JWTWithConfig for RS256 and ES256
+func JWT(secret []byte) echo.MiddlewareFunc {
+	return JWTWithConfig(JWTConfig{Secret: secret})
+}
+
+// JWTWithConfig verifies the bearer token of the Authorization header and puts its claims
+// in the echo context and the request context, see ClaimsFromContext.
+// Requests without a valid token get a 401.
+func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.JWKSRefresh == 0 {
+		config.JWKSRefresh = time.Hour
+	}
+	if config.Leeway == 0 {
+		config.Leeway = 30 * time.Second
+	}
+
+	methods := []string{}
+	if len(config.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	var keys *keySet
+	if config.JWKSFile != "" || config.JWKSURL != "" {
+		keys = newKeySet(config.JWKSFile, config.JWKSURL, config.JWKSRefresh)
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(methods) == 0 {
+		panic("JWT needs a Secret, a JWKSFile or a JWKSURL")
+	}
+
+	// the algorithm is pinned by the key type so an RSA public key can never be used as an HMAC secret
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if token.Method == jwt.SigningMethodHS256 {
+			return config.Secret, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := keys.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if token.Method == jwt.SigningMethodRS256 {
+				return key, nil
+			}
+		case *ecdsa.PublicKey:
+			if token.Method == jwt.SigningMethodES256 {
+				return key, nil
+			}
+		}
+		return nil, errors.New("key " + kid + " does not verify " + token.Method.Alg())
+	}
+	parser := &jwt.Parser{ValidMethods: methods, SkipClaimsValidation: true}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			raw := bearerToken(c)
+			if raw == "" {
+				if config.Optional {
+					return next(c)
+				}
+				return httperror.Unauthorized401(c)
+			}
+
+			claims := &Claims{}
+			if _, err := parser.ParseWithClaims(raw, claims, keyFunc); err != nil {
+				log.Debug().Err(err).Msg("invalid jwt")
+				return httperror.Unauthorized401(c, "Invalid token")
+			}
+			if !config.AllowNoExpiration && claims.ExpiresAt == 0 {
+				return httperror.Unauthorized401(c, "Invalid token")
+			}
+			if err := claims.validate(time.Now(), config.Leeway, config.Issuer, config.Audience); err != nil {
+				log.Debug().Err(err).Msg("invalid jwt claims")
+				return httperror.Unauthorized401(c, "Invalid token")
+			}
+
+			c.Set("claims", claims)
+			if claims.PlatformId != "" {
+				c.Set("platformId", claims.PlatformId)
+			}
+			ctx := context.WithValue(c.Request().Context(), claimsContextKey{}, claims)
+			c.SetRequest(c.Request().WithContext(ctx))
+			LoggerWith(c, func(l zerolog.Context) zerolog.Context {
+				return l.Str("principal", claims.Subject).Str("platform_id", claims.PlatformId)
+			})
+			return next(c)
+		}
+	}
+}
+
+// ClaimsFromContext returns the claims of the token verified by the JWT middleware
+func ClaimsFromContext(c echo.Context) (*Claims, bool) {
+	claims, ok := c.Get("claims").(*Claims)
+	return claims, ok
+}
+
+// ClaimsFromRequestContext returns the claims of the token verified by the JWT middleware,
+// for code that only has access to the request context
+func ClaimsFromRequestContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+func bearerToken(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PublicKey, ecKey *ecdsa.PublicKey) string {
+	data, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+	}})
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(file, data, 0600))
+	return file
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return raw
+}
+
+func serveJWT(e *echo.Echo, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.Use(JWTWithConfig(JWTConfig{
+		Secret:   secret,
+		JWKSFile: writeJWKS(t, &rsaKey.PublicKey, &ecKey.PublicKey),
+		Issuer:   "https://auth.string.xyz",
+		Audience: "api",
+	}))
+	e.GET("/", func(c echo.Context) error {
+		claims, ok := ClaimsFromContext(c)
+		assert.True(t, ok)
+		_, ok = ClaimsFromRequestContext(c.Request().Context())
+		assert.True(t, ok)
+		assert.Equal(t, "platform", c.Get("platformId"))
+		assert.Equal(t, "user", claims.Subject)
+		assert.Equal(t, []string{"admin"}, claims.Roles)
+		assert.Equal(t, "value", claims.Custom["custom"])
+		return c.NoContent(http.StatusOK)
+	})
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": "https://auth.string.xyz", "aud": []string{"web", "api"}, "sub": "user",
+			"exp": time.Now().Add(time.Minute).Unix(), "platformId": "platform", "roles": []string{"admin"},
+			"custom": "value",
+		}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		claims[key] = value
+		return claims
+	}
+
+	assert.Equal(t, http.StatusOK, serveJWT(e, sign(t, jwt.SigningMethodHS256, "", secret, valid())))
+	assert.Equal(t, http.StatusOK, serveJWT(e, sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, valid())))
+	assert.Equal(t, http.StatusOK, serveJWT(e, sign(t, jwt.SigningMethodES256, "ec", ecKey, valid())))
+	// within the leeway
+	assert.Equal(t, http.StatusOK, serveJWT(e, sign(t, jwt.SigningMethodHS256, "", secret, with("exp", time.Now().Add(-10*time.Second).Unix()))))
+
+	for name, token := range map[string]string{
+		"missing":        "",
+		"malformed":      "not.a.token",
+		"wrong secret":   sign(t, jwt.SigningMethodHS256, "", []byte("other"), valid()),
+		"expired":        sign(t, jwt.SigningMethodHS256, "", secret, with("exp", time.Now().Add(-time.Minute).Unix())),
+		"no exp":         sign(t, jwt.SigningMethodHS256, "", secret, with("exp", nil)),
+		"not yet valid":  sign(t, jwt.SigningMethodHS256, "", secret, with("nbf", time.Now().Add(time.Minute).Unix())),
+		"wrong issuer":   sign(t, jwt.SigningMethodHS256, "", secret, with("iss", "https://evil.io")),
+		"wrong audience": sign(t, jwt.SigningMethodHS256, "", secret, with("aud", "web")),
+		"unknown kid":    sign(t, jwt.SigningMethodRS256, "other", rsaKey, valid()),
+		"wrong key type": sign(t, jwt.SigningMethodES256, "rsa", ecKey, valid()),
+		"not allowed":    sign(t, jwt.SigningMethodRS512, "rsa", rsaKey, valid()),
+		// an attacker signing HS256 with the RSA public key as the secret
+		"alg confusion": sign(t, jwt.SigningMethodHS256, "rsa", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey), valid()),
+	} {
+		assert.Equal(t, http.StatusUnauthorized, serveJWT(e, token), name)
+	}
+}
+
+func TestJWTOptional(t *testing.T) {
+	e := echo.New()
+	e.Use(JWTWithConfig(JWTConfig{Secret: []byte("secret"), Optional: true}))
+	e.GET("/", func(c echo.Context) error {
+		_, ok := ClaimsFromContext(c)
+		assert.False(t, ok)
+		return c.NoContent(http.StatusOK)
+	})
+
+	assert.Equal(t, http.StatusOK, serveJWT(e, ""))
+	assert.Equal(t, http.StatusUnauthorized, serveJWT(e, "not.a.token"))
+	assert.Panics(t, func() { JWTWithConfig(JWTConfig{}) })
+}
@@ -3,58 +3,147 @@ package middleware
 import (
 	"net/http"
 	"os"
+	"sync/atomic"
 
+	"github.com/String-xyz/go-lib/v2/session"
 	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	ddmiddleware "gopkg.in/DataDog/dd-trace-go.v1/contrib/labstack/echo.v4"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
-func CORS() echo.MiddlewareFunc {
-	return echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch},
-		AllowCredentials: true, // allow cookie auth
-	})
-}
-
-func Recover() echo.MiddlewareFunc {
-	return echomiddleware.Recover()
-}
-
+// Logger gives every request a child of logger carrying the request id, the trace and span ids,
+// the route, the method and, once authenticated, the principal. It is stored as "logger" in the
+// echo context and in the request context, where zerolog.Ctx finds it.
+// Keep in mind that the request id and tracer middlewares must be added before this middleware.
 func Logger(logger *zerolog.Logger) echo.MiddlewareFunc {
+	if logger == nil {
+		logger = &log.Logger
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			c.Set("logger", logger)
+			fields := logger.With().
+				Str("request_id", requestId(c)).
+				Str("route", c.Path()).
+				Str("method", c.Request().Method)
+			if span, ok := tracer.SpanFromContext(c.Request().Context()); ok {
+				fields = fields.Uint64("dd.trace_id", span.Context().TraceID()).Uint64("dd.span_id", span.Context().SpanID())
+			}
+			if s, ok := session.FromContext(c); ok {
+				fields = fields.Str("principal", s.UserId)
+			}
+
+			child := fields.Logger()
+			setLogger(c, &child)
 			return next(c)
 		}
 	}
 }
 
+// LoggerWith adds fields to the logger of the request, e.g. once it is authenticated.
+// It does nothing without the Logger middleware.
+func LoggerWith(c echo.Context, fields func(zerolog.Context) zerolog.Context) {
+	logger, ok := c.Get("logger").(*zerolog.Logger)
+	if !ok {
+		return
+	}
+	child := fields(logger.With()).Logger()
+	setLogger(c, &child)
+}
+
+func setLogger(c echo.Context, logger *zerolog.Logger) {
+	c.Set("logger", logger)
+	c.SetRequest(c.Request().WithContext(logger.WithContext(c.Request().Context())))
+}
+
+// Principal identifies who the request was authenticated as, by APIKeyAuth, JWT or the
+// session middleware, or is empty for anonymous requests. Middlewares keyed on it must
+// run after authentication.
+func Principal(c echo.Context) string {
+	if key, ok := c.Get("apiKey").(*APIKey); ok {
+		return "apikey:" + key.Id
+	}
+	if claims, ok := c.Get("claims").(*Claims); ok && claims.Subject != "" {
+		return "jwt:" + claims.Subject
+	}
+	if s, ok := session.FromContext(c); ok {
+		return "user:" + s.UserId
+	}
+	if platformId, ok := c.Get("platformId").(string); ok && platformId != "" {
+		return "platform:" + platformId
+	}
+	return ""
+}
+
+type LogRequestConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	// SkipPaths are not logged, e.g. health checks hit every few seconds
+	SkipPaths []string
+	// SampleSuccesses logs one in every SampleSuccesses successful requests, 0 logs them all.
+	// Failed requests are always logged.
+	SampleSuccesses uint64
+	// LogSizes logs the request content length and the response size
+	LogSizes bool
+	// LogUserAgent logs the User-Agent header
+	LogUserAgent bool
+	// LogRemoteIP logs the client ip
+	LogRemoteIP bool
+	// LogRoute logs the route template, e.g. /users/:id, along with the path
+	LogRoute bool
+}
+
 // LogRequest is a middleware that logs the request and extracts the span Id and trace Id from the context
 // it give us the ability to trace and correlate the request in the logs as well as the starting
 // point of the root span, which is use to trace the request through the system
 // the span id and trace id are logged as dd.span_id and dd.trace_id for datadog to pick them up.
-// Keep in mind that the tracer middleware must be added before this middleware.
+// The tracer middleware should be added before this middleware, without it the trace ids are omitted.
 func LogRequest() echo.MiddlewareFunc {
+	return LogRequestWithConfig(LogRequestConfig{})
+}
+
+// LogRequestWithConfig logs with the request logger set by the Logger middleware, which already
+// carries the request and trace ids, falling back to the global logger.
+func LogRequestWithConfig(config LogRequestConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	skipPaths := map[string]bool{}
+	for _, path := range config.SkipPaths {
+		skipPaths[path] = true
+	}
+	var successes uint64
+
 	return echomiddleware.RequestLoggerWithConfig(echomiddleware.RequestLoggerConfig{
-		LogURI:       true,
-		LogStatus:    true,
-		LogRequestID: true,
-		LogLatency:   true,
-		LogMethod:    true,
-		LogHost:      true,
-		LogError:     true,
+		Skipper: func(c echo.Context) bool {
+			return skipPaths[c.Request().URL.Path] || config.Skipper(c)
+		},
+		LogURI:           true,
+		LogStatus:        true,
+		LogRequestID:     true,
+		LogLatency:       true,
+		LogMethod:        true,
+		LogHost:          true,
+		LogError:         true,
+		LogRoutePath:     config.LogRoute,
+		LogUserAgent:     config.LogUserAgent,
+		LogRemoteIP:      config.LogRemoteIP,
+		LogContentLength: config.LogSizes,
+		LogResponseSize:  config.LogSizes,
 		LogValuesFunc: func(c echo.Context, v echomiddleware.RequestLoggerValues) error {
-			env := os.Getenv("ENV")
-			logger := c.Get("logger").(*zerolog.Logger)
-			// we need the span to get the traceId and spanId
-			// and log them, datadog needs these two values to be logged to correlate the logs with the traces
-			span, ok := tracer.SpanFromContext(c.Request().Context())
-			if !ok {
-				logger.Warn().Msg("no span found in context")
+			failed := v.Error != nil || v.Status >= http.StatusBadRequest
+			if !failed && config.SampleSuccesses > 1 && atomic.AddUint64(&successes, 1)%config.SampleSuccesses != 1 {
+				return nil
+			}
+
+			logger, fromContext := c.Get("logger").(*zerolog.Logger)
+			if !fromContext {
+				logger = &log.Logger
 			}
+
 			var logEvent *zerolog.Event
 			if v.Error != nil {
 				logEvent = logger.Error().Err(v.Error)
@@ -62,16 +151,34 @@ func LogRequest() echo.MiddlewareFunc {
 				logEvent = logger.Info()
 			}
 
+			// the request logger already has these
+			if !fromContext {
+				logEvent = logEvent.Str("method", v.Method).Str("request_id", v.RequestID)
+				// we need the span to get the traceId and spanId
+				// and log them, datadog needs these two values to be logged to correlate the logs with the traces
+				if span, ok := tracer.SpanFromContext(c.Request().Context()); ok {
+					logEvent = logEvent.Uint64("dd.trace_id", span.Context().TraceID()).Uint64("dd.span_id", span.Context().SpanID())
+				}
+				if config.LogRoute {
+					logEvent = logEvent.Str("route", v.RoutePath)
+				}
+			}
+			if config.LogSizes {
+				logEvent = logEvent.Str("content_length", v.ContentLength).Int64("response_size", v.ResponseSize)
+			}
+			if config.LogUserAgent {
+				logEvent = logEvent.Str("user_agent", v.UserAgent)
+			}
+			if config.LogRemoteIP {
+				logEvent = logEvent.Str("remote_ip", v.RemoteIP)
+			}
+
 			logEvent.
 				Str("path", v.URI).
-				Str("method", v.Method).
 				Int("status_code", v.Status).
-				Str("request_id", v.RequestID).
 				Str("host", v.Host).
 				Dur("latency", v.Latency).
-				Uint64("dd.trace_id", span.Context().TraceID()).
-				Uint64("dd.span_id", span.Context().SpanID()).
-				Str("env", env).
+				Str("env", os.Getenv("ENV")).
 				Msg("request")
 			return nil
 		},
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestLogger(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	out := &bytes.Buffer{}
+	logger := zerolog.New(out)
+
+	e := echo.New()
+	e.Use(RequestId(), Tracer("test"), Logger(&logger))
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			LoggerWith(c, func(l zerolog.Context) zerolog.Context { return l.Str("principal", "usr_1") })
+			return next(c)
+		}
+	}
+	e.GET("/users/:id", func(c echo.Context) error {
+		zerolog.Ctx(c.Request().Context()).Info().Msg("from request context")
+		c.Get("logger").(*zerolog.Logger).Info().Msg("from echo context")
+		return c.NoContent(http.StatusOK)
+	}, authenticate)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/usr_1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		fields := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &fields))
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), fields["request_id"])
+		assert.Equal(t, "/users/:id", fields["route"])
+		assert.Equal(t, http.MethodGet, fields["method"])
+		assert.Equal(t, "usr_1", fields["principal"])
+		assert.NotZero(t, fields["dd.trace_id"])
+		assert.NotZero(t, fields["dd.span_id"])
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	out := &bytes.Buffer{}
+	global := log.Logger
+	log.Logger = zerolog.New(out)
+	defer func() { log.Logger = global }()
+
+	// neither the tracer nor the logger middleware are used
+	e := echo.New()
+	e.Use(LogRequestWithConfig(LogRequestConfig{
+		SkipPaths:       []string{"/health"},
+		SampleSuccesses: 2,
+		LogSizes:        true,
+		LogUserAgent:    true,
+		LogRoute:        true,
+	}))
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/users/:id", func(c echo.Context) error {
+		if c.Param("id") == "missing" {
+			return c.String(http.StatusNotFound, "not found")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+
+	serve := func(path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", "test")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("/health")
+	for i := 0; i < 4; i++ {
+		serve("/users/usr_1")
+	}
+	serve("/users/missing")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	// half of the successes and every failure
+	assert.Len(t, lines, 3)
+	fields := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &fields))
+	assert.Equal(t, "/users/missing", fields["path"])
+	assert.Equal(t, "/users/:id", fields["route"])
+	assert.Equal(t, float64(http.StatusNotFound), fields["status_code"])
+	assert.Equal(t, float64(len("not found")), fields["response_size"])
+	assert.Equal(t, "test", fields["user_agent"])
+	assert.NotContains(t, fields, "dd.trace_id")
+}
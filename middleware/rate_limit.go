@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/database"
+	"github.com/String-xyz/go-lib/v2/httperror"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+type RateLimitConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	Limiter *database.RateLimiter
+	// KeyFunc identifies who is being limited, defaults to RateLimitByIP
+	KeyFunc func(c echo.Context) string
+}
+
+// RateLimitByIP limits requests per client ip
+func RateLimitByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// RateLimitByAPIKey limits requests per api key authenticated by APIKeyAuth, falling back
+// to the client ip for requests without one. It must run after APIKeyAuth, the raw header
+// is never used so made up keys can't get a fresh limit on every request.
+func RateLimitByAPIKey(c echo.Context) string {
+	if key, ok := APIKeyFromContext(c); ok {
+		return "key:" + key.Id
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimit limits requests per client ip with the given limiter
+func RateLimit(limiter *database.RateLimiter) echo.MiddlewareFunc {
+	return RateLimitWithConfig(RateLimitConfig{Limiter: limiter})
+}
+
+// RateLimitWithConfig rejects requests over the limit with a 429 and reports the
+// state of the window in the X-RateLimit-* headers.
+// If redis is unavailable the request is let through, we would rather serve
+// than go down with the cache.
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.Limiter == nil {
+		panic("RateLimit needs a Limiter")
+	}
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitByIP
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			result, err := config.Limiter.Allow(c.Request().Context(), config.KeyFunc(c))
+			if err != nil {
+				log.Warn().Err(err).Msg("rate limiter unavailable, allowing request")
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("X-RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+
+			if !result.Allowed {
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(seconds(result.ResetAfter)))
+				return httperror.TooManyRequests429(c)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds as expected by Retry-After
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
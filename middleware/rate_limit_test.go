@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/database"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := database.NewRedisStoreFromClient(redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1}))
+
+	keys := &apiKeyMap{keys: map[string]APIKey{
+		common.ToSha256("key_1"): {Id: "key_1"},
+		common.ToSha256("key_2"): {Id: "key_2"},
+	}}
+
+	e := echo.New()
+	e.Use(APIKeyAuthWithConfig(APIKeyConfig{
+		Store: keys,
+		// unknown keys go through to be limited by ip
+		Skipper: func(c echo.Context) bool {
+			_, err := keys.GetByHash(c.Request().Context(), common.ToSha256(c.Request().Header.Get("X-Api-Key")))
+			return err != nil
+		},
+	}))
+	e.Use(RateLimitWithConfig(RateLimitConfig{
+		Limiter: database.NewRateLimiter(store, 1, time.Minute),
+		KeyFunc: RateLimitByAPIKey,
+	}))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	serve := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("key_1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+
+	rec = serve("key_1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, http.StatusOK, serve("key_2").Code)
+
+	// made up keys don't get a limit of their own
+	assert.Equal(t, http.StatusOK, serve("random_1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("random_2").Code)
+
+	// requests are let through while redis is down
+	server.Close()
+	assert.Equal(t, http.StatusOK, serve("key_1").Code)
+
+	assert.Panics(t, func() { RateLimit(nil) })
+}
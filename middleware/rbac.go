@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/httperror"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+// PermissionProvider tells which permissions a role, e.g. a MemberRole, grants
+type PermissionProvider interface {
+	Permissions(ctx context.Context, role string) ([]string, error)
+}
+
+// StaticPermissions maps roles to their permissions in code, unknown roles grant nothing
+type StaticPermissions map[string][]string
+
+func (p StaticPermissions) Permissions(ctx context.Context, role string) ([]string, error) {
+	return p[role], nil
+}
+
+// RolesFunc returns the roles of whoever makes the request
+type RolesFunc func(c echo.Context) []string
+
+// DefaultRoles reads the roles of the token verified by the JWT middleware,
+// falling back to the []string set as "roles" in the echo context
+func DefaultRoles(c echo.Context) []string {
+	if claims, ok := ClaimsFromContext(c); ok && len(claims.Roles) > 0 {
+		return claims.Roles
+	}
+	roles, _ := c.Get("roles").([]string)
+	return roles
+}
+
+type RBACConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper  echomiddleware.Skipper
+	Provider PermissionProvider
+	// RolesFunc defaults to DefaultRoles
+	RolesFunc RolesFunc
+}
+
+// RBAC checks the permissions declared by routes against the roles of the request, e.g.
+//
+//	rbac := middleware.NewRBAC(middleware.RBACConfig{Provider: provider})
+//	e.POST("/transactions", handler, rbac.Require("transactions:write"))
+//
+// A permission ending in * grants every permission it prefixes, "*" alone grants them all.
+type RBAC struct {
+	config RBACConfig
+}
+
+func NewRBAC(config RBACConfig) *RBAC {
+	if config.Provider == nil {
+		panic("RBAC needs a Provider")
+	}
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.RolesFunc == nil {
+		config.RolesFunc = DefaultRoles
+	}
+	return &RBAC{config: config}
+}
+
+// Require lets the request through only if its roles grant every permission, otherwise it gets a 403
+func (r *RBAC) Require(permissions ...string) echo.MiddlewareFunc {
+	return r.middleware(permissions, true)
+}
+
+// RequireAny lets the request through if its roles grant at least one of the permissions, otherwise it gets a 403
+func (r *RBAC) RequireAny(permissions ...string) echo.MiddlewareFunc {
+	return r.middleware(permissions, false)
+}
+
+// Allowed reports whether the roles of the request grant the permission, for checks
+// that depend on the resource and cannot be declared on the route
+func (r *RBAC) Allowed(c echo.Context, permission string) (bool, error) {
+	granted, err := r.granted(c)
+	if err != nil {
+		return false, common.StringError(err)
+	}
+	return granted.allows(permission), nil
+}
+
+func (r *RBAC) middleware(permissions []string, all bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if r.config.Skipper(c) {
+				return next(c)
+			}
+
+			granted, err := r.granted(c)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to load role permissions")
+				return httperror.Internal500(c)
+			}
+
+			matched := 0
+			for _, permission := range permissions {
+				if granted.allows(permission) {
+					matched++
+				}
+			}
+			if (all && matched < len(permissions)) || (!all && matched == 0) {
+				log.Warn().Strs("roles", r.config.RolesFunc(c)).Strs("required", permissions).Bool("all", all).
+					Str("method", c.Request().Method).Str("path", c.Path()).Msg("permission denied")
+				return httperror.Forbidden403(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+type permissionSet map[string]bool
+
+func (r *RBAC) granted(c echo.Context) (permissionSet, error) {
+	granted := permissionSet{}
+	for _, role := range r.config.RolesFunc(c) {
+		permissions, err := r.config.Provider.Permissions(c.Request().Context(), role)
+		if err != nil {
+			return nil, common.StringError(err, "role "+role)
+		}
+		for _, permission := range permissions {
+			granted[permission] = true
+		}
+	}
+	return granted, nil
+}
+
+func (s permissionSet) allows(permission string) bool {
+	if s[permission] {
+		return true
+	}
+	for granted := range s {
+		if strings.HasSuffix(granted, "*") && strings.HasPrefix(permission, strings.TrimSuffix(granted, "*")) {
+			return true
+		}
+	}
+	return false
+}
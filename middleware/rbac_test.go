@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRBAC(t *testing.T) {
+	rbac := NewRBAC(RBACConfig{Provider: StaticPermissions{
+		"owner":  {"*"},
+		"admin":  {"transactions:*", "members:read"},
+		"viewer": {"transactions:read"},
+	}})
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if roles := c.Request().Header.Get("X-Roles"); roles != "" {
+				c.Set("roles", strings.Split(roles, ","))
+			}
+			return next(c)
+		}
+	})
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/transactions", ok, rbac.Require("transactions:read"))
+	e.POST("/members", ok, rbac.Require("members:read", "members:write"))
+	e.GET("/report", ok, rbac.RequireAny("members:read", "reports:read"))
+
+	serve := func(method string, path string, roles string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Roles", roles)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/transactions", "viewer"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/transactions", "admin"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/transactions", ""))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/transactions", "unknown"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/members", "admin"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/members", "owner"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/report", "admin"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/report", "viewer"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/report", "viewer,admin"))
+
+	assert.Panics(t, func() { NewRBAC(RBACConfig{}) })
+}
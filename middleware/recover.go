@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/String-xyz/go-lib/v2/httperror"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+type RecoverConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	// StackSize is how many bytes of the stack are logged, defaults to 4KB
+	StackSize int
+	// AllStacks logs the stack of every goroutine, not only the panicking one
+	AllStacks bool
+}
+
+// Recover turns panics into a 500, see RecoverWithConfig
+func Recover() echo.MiddlewareFunc {
+	return RecoverWithConfig(RecoverConfig{})
+}
+
+// RecoverWithConfig recovers from panics in the next handlers, logs them with their stack, request id
+// and trace ids, marks the datadog span as errored and answers with a JSON 500.
+// Keep in mind that the tracer middleware must be added before this middleware.
+func RecoverWithConfig(config RecoverConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+	if config.StackSize == 0 {
+		config.StackSize = 4 << 10
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (returnErr error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				// the server aborts the response on purpose with this one, let it through
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+
+				err, ok := r.(error)
+				if !ok {
+					err = fmt.Errorf("%v", r)
+				}
+				err = errors.Wrap(err, "panic")
+				stack := make([]byte, config.StackSize)
+				stack = stack[:runtime.Stack(stack, config.AllStacks)]
+
+				logger := &log.Logger
+				if l, ok := c.Get("logger").(*zerolog.Logger); ok {
+					logger = l
+				}
+				event := logger.Error().Err(err).Str("stack", string(stack)).
+					Str("method", c.Request().Method).Str("path", c.Path()).Str("request_id", requestId(c))
+				if span, ok := tracer.SpanFromContext(c.Request().Context()); ok {
+					span.SetTag(ext.Error, err)
+					span.SetTag(ext.ErrorStack, string(stack))
+					event = event.Uint64("dd.trace_id", span.Context().TraceID()).Uint64("dd.span_id", span.Context().SpanID())
+				}
+				event.Msg("recovered from panic")
+
+				if !c.Response().Committed {
+					if err := httperror.Internal500(c); err != nil {
+						log.Warn().Err(err).Msg("failed to write panic response")
+					}
+				}
+				// the response is already written, returning the error lets the tracer and the
+				// request logger report the panic rather than a bare 500
+				returnErr = err
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// requestId returns the id set by the RequestId middleware, or sent by the client
+func requestId(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/String-xyz/go-lib/v2/httperror"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestRecover(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	out := &bytes.Buffer{}
+	logger := zerolog.New(out)
+
+	e := echo.New()
+	e.Use(RequestId(), Tracer("test"), Logger(&logger), Recover())
+	e.GET("/", func(c echo.Context) error {
+		var m map[string]string
+		m["boom"] = "boom"
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	body := httperror.JSONError{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "INTERNAL_SERVER", body.Code)
+
+	line := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "recovered from panic", line["message"])
+	assert.Contains(t, line["error"], "assignment to entry in nil map")
+	assert.Contains(t, line["stack"], "TestRecover")
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), line["request_id"])
+	assert.NotZero(t, line["dd.trace_id"])
+
+	spans := mt.FinishedSpans()
+	assert.Len(t, spans, 1)
+	assert.Contains(t, spans[0].Tag(ext.Error).(error).Error(), "assignment to entry in nil map")
+}
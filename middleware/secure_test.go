@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecure(t *testing.T) {
+	t.Setenv("ENV", "prod")
+
+	config := DefaultSecureConfig
+	config.Routes = map[string]map[string]string{
+		"/docs": {"content-security-policy": "default-src 'self'", "X-Frame-Options": ""},
+	}
+	e := echo.New()
+	e.Use(SecureWithConfig(config))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/", ok)
+	e.GET("/docs", ok)
+
+	serve := func(path string) http.Header {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Header()
+	}
+
+	header := serve("/")
+	assert.Equal(t, "max-age=31536000; includeSubDomains", header.Get(echo.HeaderStrictTransportSecurity))
+	assert.Equal(t, "nosniff", header.Get(echo.HeaderXContentTypeOptions))
+	assert.Equal(t, "DENY", header.Get(echo.HeaderXFrameOptions))
+	assert.Equal(t, "no-referrer", header.Get(echo.HeaderReferrerPolicy))
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", header.Get(echo.HeaderContentSecurityPolicy))
+
+	header = serve("/docs")
+	assert.Equal(t, "default-src 'self'", header.Get(echo.HeaderContentSecurityPolicy))
+	assert.Empty(t, header.Get(echo.HeaderXFrameOptions))
+	assert.Equal(t, "nosniff", header.Get(echo.HeaderXContentTypeOptions))
+
+	// no HSTS when developing over plain http
+	t.Setenv("ENV", "local")
+	e = echo.New()
+	e.Use(Secure())
+	e.GET("/", ok)
+	header = serve("/")
+	assert.Empty(t, header.Get(echo.HeaderStrictTransportSecurity))
+	assert.Equal(t, "nosniff", header.Get(echo.HeaderXContentTypeOptions))
+}
@@ -0,0 +1,138 @@
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/httperror"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type contextKey struct{}
+
+type MiddlewareConfig struct {
+	// Skipper defines a function to skip the middleware
+	Skipper echomiddleware.Skipper
+	Store   *Store
+	// Required rejects requests without a valid session with a 401
+	Required bool
+}
+
+// Middleware loads the session from the cookie, if any, without requiring it
+func Middleware(store *Store) echo.MiddlewareFunc {
+	return MiddlewareWithConfig(MiddlewareConfig{Store: store})
+}
+
+// MiddlewareWithConfig loads the session referenced by the cookie into the echo context
+// and the request context, and slides its expiration forward.
+func MiddlewareWithConfig(config MiddlewareConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = echomiddleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			session, err := config.Store.load(c)
+			if err == nil {
+				err = config.Store.Touch(ctx, session)
+				// the session is only dropped if it was destroyed since it was loaded
+				if err != nil && !serror.Is(err, serror.NOT_FOUND) {
+					log.Warn().Err(err).Msg("failed to refresh session")
+					err = nil
+				}
+			}
+			if err != nil {
+				if !serror.Is(err, serror.NOT_FOUND) {
+					log.Warn().Err(err).Msg("failed to load session")
+				}
+				if config.Required {
+					return httperror.Unauthorized401(c)
+				}
+				return next(c)
+			}
+
+			if err := config.Store.SetCookie(c, session); err != nil {
+				log.Warn().Err(err).Msg("failed to refresh session cookie")
+			}
+
+			ctx = context.WithValue(ctx, contextKey{}, session)
+			// add the user to the request logger set by the Logger middleware, if any
+			if logger, ok := c.Get("logger").(*zerolog.Logger); ok {
+				child := logger.With().Str("principal", session.UserId).Logger()
+				c.Set("logger", &child)
+				ctx = child.WithContext(ctx)
+			}
+			c.Set("session", session)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// FromContext returns the session loaded by the middleware
+func FromContext(c echo.Context) (*Session, bool) {
+	session, ok := c.Get("session").(*Session)
+	return session, ok
+}
+
+// FromRequestContext returns the session loaded by the middleware, for code
+// that only has access to the request context
+func FromRequestContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(contextKey{}).(*Session)
+	return session, ok
+}
+
+// SetCookie writes the encrypted session id to the response, e.g. after login
+func (s *Store) SetCookie(c echo.Context, session *Session) error {
+	value, err := s.encodeId(session.Id)
+	if err != nil {
+		return common.StringError(err)
+	}
+
+	c.SetCookie(s.cookie(value, int(s.options.TTL.Seconds())))
+	return nil
+}
+
+// ClearCookie removes the session cookie from the browser, e.g. on logout
+func (s *Store) ClearCookie(c echo.Context) {
+	c.SetCookie(s.cookie("", -1))
+}
+
+func (s *Store) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.options.CookieName,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.options.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   !common.IsLocalEnv(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// load returns the session referenced by the request cookie
+func (s *Store) load(c echo.Context) (*Session, error) {
+	cookie, err := c.Cookie(s.options.CookieName)
+	if err != nil {
+		return nil, common.StringError(serror.NOT_FOUND)
+	}
+
+	id, err := s.decodeId(cookie.Value)
+	if err != nil {
+		// a tampered or stale cookie is the same as no cookie
+		return nil, common.StringError(serror.NOT_FOUND)
+	}
+
+	return s.Get(c.Request().Context(), id)
+}
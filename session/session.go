@@ -0,0 +1,204 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/common"
+	"github.com/String-xyz/go-lib/v2/database"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+)
+
+const (
+	sessionPrefix     = "session:"
+	userSessionPrefix = "session:user:"
+)
+
+type Session struct {
+	Id        string                 `json:"id"`
+	UserId    string                 `json:"userId"`
+	Data      map[string]interface{} `json:"data"`
+	CreatedAt time.Time              `json:"createdAt"`
+	// ExpiresAt is set by Save and Touch, sessions read with Get report the expiration
+	// of their last Save
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type Options struct {
+	// Secret encrypts the session id stored in the cookie, must be 16, 24 or 32 bytes long
+	Secret string
+	// TTL is how long a session lives without being used, defaults to 24 hours
+	TTL time.Duration
+	// CookieName defaults to "session"
+	CookieName   string
+	CookieDomain string
+}
+
+// Store keeps sessions in redis, each session expires after TTL without activity.
+// Sessions are also indexed per user so all of them can be revoked at once, the
+// index expires with the last session of the user.
+type Store struct {
+	redis   database.RedisStore
+	options Options
+}
+
+// NewStore panics if the secret is not a valid AES key, every cookie would be rejected otherwise
+func NewStore(redis database.RedisStore, options Options) *Store {
+	switch len(options.Secret) {
+	case 16, 24, 32:
+	default:
+		panic("session secret must be 16, 24 or 32 bytes long, got " + strconv.Itoa(len(options.Secret)))
+	}
+	if options.TTL == 0 {
+		options.TTL = 24 * time.Hour
+	}
+	if options.CookieName == "" {
+		options.CookieName = "session"
+	}
+	return &Store{redis: redis, options: options}
+}
+
+// Create starts a new session for userId with a random id
+func (s *Store) Create(ctx context.Context, userId string, data map[string]interface{}) (*Session, error) {
+	id, err := common.RandomToken(32)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	now := time.Now()
+	session := &Session{
+		Id:        id,
+		UserId:    userId,
+		Data:      data,
+		CreatedAt: now,
+	}
+
+	if err := s.Save(ctx, session); err != nil {
+		return nil, common.StringError(err)
+	}
+
+	store := s.redis.WithContext(ctx)
+	if err := store.HSet(userSessionPrefix+userId, map[string]interface{}{id: now.Unix()}); err != nil {
+		return nil, common.StringError(err)
+	}
+	if err := store.Expire(userSessionPrefix+userId, s.options.TTL); err != nil {
+		return nil, common.StringError(err)
+	}
+
+	return session, nil
+}
+
+// Get returns the session or a NOT_FOUND error if it does not exist or has expired
+func (s *Store) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.redis.WithContext(ctx).Get(sessionPrefix + id)
+	if err != nil {
+		return nil, common.StringError(err)
+	}
+
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, common.StringError(err)
+	}
+	return session, nil
+}
+
+// Save writes the session and pushes its expiration TTL into the future
+func (s *Store) Save(ctx context.Context, session *Session) error {
+	session.ExpiresAt = time.Now().Add(s.options.TTL)
+	data, err := json.Marshal(session)
+	if err != nil {
+		return common.StringError(err)
+	}
+	return common.StringError(s.redis.WithContext(ctx).Set(sessionPrefix+session.Id, string(data), s.options.TTL))
+}
+
+// Touch pushes the expiration of the session TTL into the future without writing it,
+// so a session destroyed in the meantime stays destroyed. It returns NOT_FOUND if the
+// session no longer exists.
+func (s *Store) Touch(ctx context.Context, session *Session) error {
+	store := s.redis.WithContext(ctx)
+	if err := store.Expire(sessionPrefix+session.Id, s.options.TTL); err != nil {
+		return common.StringError(err)
+	}
+	session.ExpiresAt = time.Now().Add(s.options.TTL)
+
+	// the index lives as long as the latest session of the user
+	err := store.Expire(userSessionPrefix+session.UserId, s.options.TTL)
+	if err != nil && !serror.Is(err, serror.NOT_FOUND) {
+		return common.StringError(err)
+	}
+	return nil
+}
+
+// Destroy deletes the session, e.g. on logout
+func (s *Store) Destroy(ctx context.Context, session *Session) error {
+	store := s.redis.WithContext(ctx)
+	if err := store.Delete(sessionPrefix + session.Id); err != nil {
+		return common.StringError(err)
+	}
+	if _, err := store.HDel(userSessionPrefix+session.UserId, session.Id); err != nil {
+		return common.StringError(err)
+	}
+	return nil
+}
+
+// ListForUser returns the live sessions of the user, dropping expired ones from the index
+func (s *Store) ListForUser(ctx context.Context, userId string) ([]*Session, error) {
+	store := s.redis.WithContext(ctx)
+	ids, err := store.HGetAll(userSessionPrefix + userId)
+	if err != nil {
+		if serror.Is(err, serror.NOT_FOUND) {
+			return []*Session{}, nil
+		}
+		return nil, common.StringError(err)
+	}
+
+	sessions := []*Session{}
+	for id := range ids {
+		session, err := s.Get(ctx, id)
+		if err != nil {
+			if serror.Is(err, serror.NOT_FOUND) {
+				if _, err := store.HDel(userSessionPrefix+userId, id); err != nil {
+					return nil, common.StringError(err)
+				}
+				continue
+			}
+			return nil, common.StringError(err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// DestroyAllForUser logs the user out everywhere
+func (s *Store) DestroyAllForUser(ctx context.Context, userId string) error {
+	store := s.redis.WithContext(ctx)
+	ids, err := store.HGetAll(userSessionPrefix + userId)
+	if err != nil {
+		if serror.Is(err, serror.NOT_FOUND) {
+			return nil
+		}
+		return common.StringError(err)
+	}
+
+	for id := range ids {
+		if err := store.Delete(sessionPrefix + id); err != nil {
+			return common.StringError(err)
+		}
+	}
+	return common.StringError(store.Delete(userSessionPrefix + userId))
+}
+
+// encodeId encrypts the session id for the cookie so the raw id is never exposed
+func (s *Store) encodeId(id string) (string, error) {
+	return common.Encrypt(id, s.options.Secret)
+}
+
+func (s *Store) decodeId(value string) (string, error) {
+	return common.Decrypt[string](value, s.options.Secret)
+}
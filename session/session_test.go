@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/String-xyz/go-lib/v2/database"
+	serror "github.com/String-xyz/go-lib/v2/stringerror"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	redis := database.NewMemoryRedisStore()
+	store := NewStore(redis, Options{Secret: testSecret, TTL: time.Hour})
+
+	first, err := store.Create(ctx, "usr_1", map[string]interface{}{"role": "admin"})
+	assert.NoError(t, err)
+	second, err := store.Create(ctx, "usr_1", nil)
+	assert.NoError(t, err)
+	other, err := store.Create(ctx, "usr_2", nil)
+	assert.NoError(t, err)
+
+	session, err := store.Get(ctx, first.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "usr_1", session.UserId)
+	assert.Equal(t, "admin", session.Data["role"])
+	assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpiresAt, time.Minute)
+
+	// the user index expires with the sessions
+	ttl, err := redis.TTL(userSessionPrefix + "usr_1")
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+
+	sessions, err := store.ListForUser(ctx, "usr_1")
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	assert.NoError(t, store.Destroy(ctx, first))
+	_, err = store.Get(ctx, first.Id)
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	assert.True(t, serror.Is(store.Touch(ctx, first), serror.NOT_FOUND))
+	sessions, err = store.ListForUser(ctx, "usr_1")
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	assert.NoError(t, store.DestroyAllForUser(ctx, "usr_1"))
+	_, err = store.Get(ctx, second.Id)
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+	sessions, err = store.ListForUser(ctx, "usr_1")
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// other users are not logged out
+	_, err = store.Get(ctx, other.Id)
+	assert.NoError(t, err)
+
+	assert.Panics(t, func() { NewStore(redis, Options{Secret: "too short"}) })
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	redis := database.NewMemoryRedisStore()
+	store := NewStore(redis, Options{Secret: testSecret, TTL: time.Hour})
+
+	session, err := store.Create(ctx, "usr_1", nil)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	assert.NoError(t, store.SetCookie(e.NewContext(httptest.NewRequest(http.MethodPost, "/login", nil), rec), session))
+	cookie := rec.Result().Cookies()[0]
+	assert.Equal(t, "session", cookie.Name)
+	assert.NotContains(t, cookie.Value, session.Id)
+	assert.True(t, cookie.HttpOnly)
+
+	e.Use(MiddlewareWithConfig(MiddlewareConfig{Store: store, Required: true}))
+	e.GET("/", func(c echo.Context) error {
+		loaded, ok := FromContext(c)
+		assert.True(t, ok)
+		assert.Equal(t, session.Id, loaded.Id)
+		_, ok = FromRequestContext(c.Request().Context())
+		assert.True(t, ok)
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = serve(cookie)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// the cookie expiration slides along with the session
+	assert.Equal(t, 3600, rec.Result().Cookies()[0].MaxAge)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(&http.Cookie{Name: "session", Value: "tampered"}).Code)
+
+	// requests after logging out everywhere don't bring the session back
+	assert.NoError(t, store.DestroyAllForUser(ctx, "usr_1"))
+	assert.Equal(t, http.StatusUnauthorized, serve(cookie).Code)
+	_, err = store.Get(ctx, session.Id)
+	assert.True(t, serror.Is(err, serror.NOT_FOUND))
+}
@@ -31,6 +31,9 @@ var EXPIRED = errors.New("expired")
 var UNKNOWN_DEVICE = errors.New("unknown device")
 var FUNC_NOT_ALLOWED = errors.New("function is not allowed on this contract")
 var CONTRACT_NOT_ALLOWED = errors.New("contract not allowed by platform on network")
+var LOCK_NOT_ACQUIRED = errors.New("lock not acquired")
+var LOCK_NOT_HELD = errors.New("lock not held")
+var TX_CONFLICT = errors.New("transaction aborted, a watched key changed")
 
 /* Marlon's Proposal */
 